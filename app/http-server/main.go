@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
+	"p3-graded-challenge-1-ziancarlos/auth"
 	"p3-graded-challenge-1-ziancarlos/config"
 	"p3-graded-challenge-1-ziancarlos/controllers"
+	"p3-graded-challenge-1-ziancarlos/middlewares"
+	"p3-graded-challenge-1-ziancarlos/paymentclient"
 	"p3-graded-challenge-1-ziancarlos/repository"
 	"p3-graded-challenge-1-ziancarlos/service"
+	"p3-graded-challenge-1-ziancarlos/tlsutil"
 	"time"
 
 	_ "p3-graded-challenge-1-ziancarlos/docs"
@@ -23,6 +28,10 @@ import (
 // @description API documentation for Shopping Service
 // @host localhost:9051
 // @BasePath /
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Enter "Bearer" followed by a space and the token from /auth/login
 func main() {
 	// Load configuration
 	cfg, err := config.LoadConfig()
@@ -32,8 +41,11 @@ func main() {
 
 	// Initialize Echo
 	e := echo.New()
+	e.HTTPErrorHandler = controllers.HTTPErrorHandler
+	e.Validator = controllers.NewValidator()
 
 	// Middleware
+	e.Use(middleware.RequestID())
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
@@ -67,34 +79,170 @@ func main() {
 	db := client.Database(cfg.Database.DBName)
 
 	// Initialize repositories
-	productRepo := repository.NewProductRepository(db)
-	transactionRepo := repository.NewTransactionRepository(db, cfg)
+	productRepo := repository.NewProductRepository(db, cfg.Database.Timeouts)
+	transactionRepo := repository.NewTransactionRepository(db, cfg.Database.Timeouts)
+	idempotencyRepo := repository.NewIdempotencyRepository(db, cfg.Database.Timeouts)
+	outboxRepo := repository.NewOutboxRepository(db, cfg.Database.Timeouts)
+	stockAdjustmentRepo := repository.NewStockAdjustmentRepository(db, cfg.Database.Timeouts)
+	reservationRepo := repository.NewReservationRepository(db, cfg.Database.Timeouts)
+	orderRepo := repository.NewOrderRepository(db, cfg.Database.Timeouts)
+	cartRepo := repository.NewCartRepository(db, cfg.Database.Timeouts)
+	userRepo := repository.NewUserRepository(db, cfg.Database.Timeouts)
+
+	if err := productRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal("Failed to create product indexes:", err)
+	}
+	if n, err := productRepo.MigrateLegacyMoney(context.Background()); err != nil {
+		log.Fatal("Failed to migrate product prices:", err)
+	} else if n > 0 {
+		log.Printf("Migrated %d legacy product prices", n)
+	}
+	if err := transactionRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal("Failed to create transaction indexes:", err)
+	}
+	if n, err := transactionRepo.BackfillStatus(context.Background()); err != nil {
+		log.Fatal("Failed to backfill transaction statuses:", err)
+	} else if n > 0 {
+		log.Printf("Marked %d transactions without a status as paid", n)
+	}
+	if n, err := transactionRepo.MigrateLegacyMoney(context.Background()); err != nil {
+		log.Fatal("Failed to migrate transaction amounts:", err)
+	} else if n > 0 {
+		log.Printf("Migrated %d legacy transaction amounts", n)
+	}
+	if err := idempotencyRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal("Failed to create idempotency indexes:", err)
+	}
+	if err := outboxRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal("Failed to create outbox indexes:", err)
+	}
+	if err := stockAdjustmentRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal("Failed to create stock adjustment indexes:", err)
+	}
+	if err := reservationRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal("Failed to create reservation indexes:", err)
+	}
+	if err := orderRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal("Failed to create order indexes:", err)
+	}
+	if err := cartRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal("Failed to create cart indexes:", err)
+	}
+	if err := userRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal("Failed to create user indexes:", err)
+	}
+
+	// Initialize authentication
+	signer, err := auth.NewSigner(cfg.Auth)
+	if err != nil {
+		log.Fatal("Failed to load token signing key:", err)
+	}
+	verifier, err := auth.NewVerifier(cfg.Auth)
+	if err != nil {
+		log.Fatal("Failed to load token verification keys:", err)
+	}
+	policy, err := auth.NewPolicy(cfg.Auth.Roles)
+	if err != nil {
+		log.Fatal("Failed to load access policy:", err)
+	}
+
+	// Initialize clients
+	if cfg.PaymentService.SigningSecret == "" {
+		log.Fatal("PAYMENT_SIGNING_SECRET must be set to sign payment service requests")
+	}
+	paymentClient, err := paymentclient.NewClient(cfg.PaymentService, auth.NewServiceToken(signer, "shopping-service"))
+	if err != nil {
+		log.Fatal("Failed to configure payment client:", err)
+	}
 
 	// Initialize services
-	productService := service.NewProductService(productRepo)
-	transactionService := service.NewTransactionService(transactionRepo, cfg)
+	inventory := service.NewInventory(productRepo, stockAdjustmentRepo, reservationRepo, cfg)
+	productService := service.NewProductService(productRepo, transactionRepo, orderRepo, inventory, policy)
+	reservationService := service.NewReservationService(inventory, policy)
+	transactionService := service.NewTransactionService(transactionRepo, productRepo, outboxRepo, inventory, paymentClient, policy, cfg)
+	orderService := service.NewOrderService(orderRepo, productRepo, outboxRepo, inventory, policy, cfg)
+	cartService := service.NewCartService(cartRepo, productRepo, orderService, policy, cfg)
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo, cfg.Idempotency)
+	authService := service.NewAuthService(userRepo, signer, policy)
+
+	if cfg.Auth.AdminUsername != "" && cfg.Auth.AdminPassword != "" {
+		if err := authService.EnsureUser(context.Background(), cfg.Auth.AdminUsername, cfg.Auth.AdminPassword, auth.RoleAdmin); err != nil {
+			log.Fatal("Failed to create admin user:", err)
+		}
+	}
+
+	// Background workers: one settles pending transactions and orders with
+	// the payment service, the other returns expired reservations to stock
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	go service.NewPaymentWorker(outboxRepo, transactionRepo, orderRepo, inventory, paymentClient, cfg).Run(workerCtx)
+	go service.NewReservationSweeper(inventory, cfg).Run(workerCtx)
+	go service.NewPurgeJob(productRepo, transactionRepo, cfg).Run(workerCtx)
 
 	// Initialize controllers
 	productController := controllers.NewProductController(productService)
 	transactionController := controllers.NewTransactionController(transactionService)
+	reservationController := controllers.NewReservationController(reservationService)
+	orderController := controllers.NewOrderController(orderService)
+	cartController := controllers.NewCartController(cartService)
+	authController := controllers.NewAuthController(authService)
+
+	// Routes - Auth
+	e.POST("/auth/login", authController.Login)
+
+	// Every other route needs a bearer token and the permission named on the
+	// route; see config.DefaultRoles for which roles hold which
+	api := e.Group("", middlewares.JWT(verifier))
+
+	// Routes - Users
+	api.POST("/users", authController.CreateUser, middlewares.Require(policy, auth.PermUsersWrite))
 
 	// Routes - Products
-	e.POST("/products", productController.CreateProduct)
-	e.GET("/products", productController.GetAllProducts)
-	e.GET("/products/:id", productController.GetProductByID)
-	e.PUT("/products/:id", productController.UpdateProduct)
-	e.DELETE("/products/:id", productController.DeleteProduct)
+	api.POST("/products", productController.CreateProduct, middlewares.Require(policy, auth.PermProductsWrite))
+	api.GET("/products", productController.GetAllProducts, middlewares.Require(policy, auth.PermProductsRead))
+	api.GET("/products/:id", productController.GetProductByID, middlewares.Require(policy, auth.PermProductsRead))
+	api.PUT("/products/:id", productController.UpdateProduct, middlewares.Require(policy, auth.PermProductsWrite))
+	api.DELETE("/products/:id", productController.DeleteProduct, middlewares.Require(policy, auth.PermProductsDelete))
+	api.POST("/products/:id/restore", productController.RestoreProduct, middlewares.Require(policy, auth.PermProductsDelete))
+	api.POST("/products/:id/stock", productController.AdjustStock, middlewares.Require(policy, auth.PermStockWrite))
+	api.GET("/products/:id/stock", productController.GetStockAdjustments, middlewares.Require(policy, auth.PermStockRead))
+	api.POST("/products/:id/reservations", reservationController.CreateReservation, middlewares.Require(policy, auth.PermReservationsWrite), middlewares.Idempotency(idempotencyService))
+
+	// Routes - Reservations
+	api.GET("/reservations/:id", reservationController.GetReservation, middlewares.Require(policy, auth.PermReservationsRead))
+	api.DELETE("/reservations/:id", reservationController.ReleaseReservation, middlewares.Require(policy, auth.PermReservationsWrite))
 
 	// Routes - Transactions
-	e.POST("/transactions", transactionController.CreateTransaction)
-	e.GET("/transactions", transactionController.GetAllTransactions)
-	e.GET("/transactions/:id", transactionController.GetTransactionByID)
-	e.PUT("/transactions/:id", transactionController.UpdateTransaction)
-	e.DELETE("/transactions/:id", transactionController.DeleteTransaction)
+	api.POST("/transactions", transactionController.CreateTransaction, middlewares.Require(policy, auth.PermTransactionsCreate), middlewares.Idempotency(idempotencyService))
+	api.GET("/transactions", transactionController.GetAllTransactions, middlewares.Require(policy, auth.PermTransactionsRead))
+	api.GET("/transactions/:id", transactionController.GetTransactionByID, middlewares.Require(policy, auth.PermTransactionsRead))
+	api.PUT("/transactions/:id", transactionController.UpdateTransaction, middlewares.Require(policy, auth.PermTransactionsUpdate))
+	api.DELETE("/transactions/:id", transactionController.DeleteTransaction, middlewares.Require(policy, auth.PermTransactionsDelete))
+	api.POST("/transactions/:id/restore", transactionController.RestoreTransaction, middlewares.Require(policy, auth.PermTransactionsDelete))
+	api.POST("/transactions/:id/refunds", transactionController.RefundTransaction, middlewares.Require(policy, auth.PermTransactionsRefund), middlewares.Idempotency(idempotencyService))
+	api.POST("/transactions/:id/cancel", transactionController.CancelTransaction, middlewares.Require(policy, auth.PermTransactionsCancel))
+
+	// Routes - Orders
+	api.POST("/orders", orderController.CreateOrder, middlewares.Require(policy, auth.PermOrdersCreate), middlewares.Idempotency(idempotencyService))
+	api.GET("/orders", orderController.GetAllOrders, middlewares.Require(policy, auth.PermOrdersRead))
+	api.GET("/orders/:id", orderController.GetOrderByID, middlewares.Require(policy, auth.PermOrdersRead))
+
+	// Routes - Carts
+	api.POST("/carts", cartController.CreateCart, middlewares.Require(policy, auth.PermCartsWrite))
+	api.GET("/carts/:id", cartController.GetCart, middlewares.Require(policy, auth.PermCartsWrite))
+	api.POST("/carts/:id/items", cartController.AddCartItem, middlewares.Require(policy, auth.PermCartsWrite))
+	api.PUT("/carts/:id/items/:product_id", cartController.UpdateCartItem, middlewares.Require(policy, auth.PermCartsWrite))
+	api.DELETE("/carts/:id/items/:product_id", cartController.RemoveCartItem, middlewares.Require(policy, auth.PermCartsWrite))
+	api.POST("/carts/:id/checkout", cartController.Checkout, middlewares.Require(policy, auth.PermCartsWrite), middlewares.Idempotency(idempotencyService))
 
 	// Start server
-	log.Printf("✓ Shopping Service running on port %s", cfg.Server.Port)
+	tlsConfig, err := tlsutil.ServerConfig(cfg.Server.TLS)
+	if err != nil {
+		log.Fatal("Failed to configure TLS:", err)
+	}
+	server := &http.Server{Addr: ":" + cfg.Server.Port, TLSConfig: tlsConfig}
 
-	e.Logger.Fatal(e.Start(":" + cfg.Server.Port))
-}
+	log.Printf("✓ Shopping Service running on port %s (TLS: %t)", cfg.Server.Port, tlsConfig != nil)
 
+	e.Logger.Fatal(e.StartServer(server))
+}
@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
+	"p3-graded-challenge-1-ziancarlos/auth"
 	"p3-graded-challenge-1-ziancarlos/config"
 	"p3-graded-challenge-1-ziancarlos/controllers"
+	"p3-graded-challenge-1-ziancarlos/middlewares"
 	"p3-graded-challenge-1-ziancarlos/repository"
 	"p3-graded-challenge-1-ziancarlos/service"
+	"p3-graded-challenge-1-ziancarlos/signing"
+	"p3-graded-challenge-1-ziancarlos/tlsutil"
 	"time"
 
 	_ "p3-graded-challenge-1-ziancarlos/docs"
@@ -20,7 +25,7 @@ import (
 
 // @title Payment Service API
 // @version 1.0
-// @description API documentation for Payment Service
+// @description API documentation for Payment Service. Every /payments request must carry a bearer token and an HMAC signature (X-Signature-Timestamp, X-Signature-Nonce, X-Signature) made with the shared PAYMENT_SIGNING_SECRET.
 // @host localhost:9061
 // @BasePath /
 func main() {
@@ -30,7 +35,10 @@ func main() {
 	}
 
 	e := echo.New()
+	e.HTTPErrorHandler = controllers.HTTPErrorHandler
+	e.Validator = controllers.NewValidator()
 
+	e.Use(middleware.RequestID())
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
@@ -52,13 +60,82 @@ func main() {
 	}()
 
 	db := client.Database(cfg.Database.DBName)
-	paymentRepo := repository.NewPaymentRepository(db)
-	paymentService := service.NewPaymentService(paymentRepo)
+	paymentRepo := repository.NewPaymentRepository(db, cfg.Database.Timeouts)
+	refundRepo := repository.NewRefundRepository(db, cfg.Database.Timeouts)
+	idempotencyRepo := repository.NewIdempotencyRepository(db, cfg.Database.Timeouts)
+	nonceRepo := repository.NewNonceRepository(db, cfg.Database.Timeouts)
+	if err := paymentRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal("Failed to create payment indexes:", err)
+	}
+	if n, err := paymentRepo.BackfillStatus(context.Background()); err != nil {
+		log.Fatal("Failed to backfill payment statuses:", err)
+	} else if n > 0 {
+		log.Printf("Marked %d payments without a status as captured", n)
+	}
+	if n, err := paymentRepo.MigrateLegacyMoney(context.Background()); err != nil {
+		log.Fatal("Failed to migrate payment amounts:", err)
+	} else if n > 0 {
+		log.Printf("Migrated %d legacy payment amounts", n)
+	}
+	if err := refundRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal("Failed to create refund indexes:", err)
+	}
+	if n, err := refundRepo.MigrateLegacyMoney(context.Background()); err != nil {
+		log.Fatal("Failed to migrate refund amounts:", err)
+	} else if n > 0 {
+		log.Printf("Migrated %d legacy refund amounts", n)
+	}
+	if err := idempotencyRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal("Failed to create idempotency indexes:", err)
+	}
+	if err := nonceRepo.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal("Failed to create nonce indexes:", err)
+	}
+
+	if cfg.Signing.Secret == "" {
+		log.Fatal("PAYMENT_SIGNING_SECRET must be set to verify signed requests")
+	}
+	signatures := signing.NewVerifier([]byte(cfg.Signing.Secret), cfg.Signing.MaxSkew, nonceRepo)
+
+	verifier, err := auth.NewVerifier(cfg.Auth)
+	if err != nil {
+		log.Fatal("Failed to load token verification keys:", err)
+	}
+	policy, err := auth.NewPolicy(cfg.Auth.Roles)
+	if err != nil {
+		log.Fatal("Failed to load access policy:", err)
+	}
+
+	paymentService := service.NewPaymentService(paymentRepo, refundRepo)
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo, cfg.Idempotency)
 	paymentController := controllers.NewPaymentController(paymentService)
 
-	e.POST("/payments", paymentController.CreatePayment)
+	idempotent := middlewares.Idempotency(idempotencyService)
+	canRead := middlewares.Require(policy, auth.PermPaymentsRead)
+	canWrite := middlewares.Require(policy, auth.PermPaymentsWrite)
+	canRefund := middlewares.Require(policy, auth.PermPaymentsRefund)
 
-	log.Printf("✓ Payment Service running on port %s", cfg.Server.Port)
-	e.Logger.Fatal(e.Start(":" + cfg.Server.Port))
-}
+	// Callers, normally the shopping service, sign every request with the
+	// shared secret and authenticate with a bearer token. The body is read
+	// before either is checked, so its size is capped first.
+	api := e.Group("", middleware.BodyLimit(cfg.Signing.MaxBodySize), middlewares.RequireSignature(signatures), middlewares.JWT(verifier))
 
+	api.POST("/payments", paymentController.CreatePayment, canWrite, idempotent)
+	api.GET("/payments", paymentController.GetAllPayments, canRead)
+	api.GET("/payments/:id", paymentController.GetPaymentByID, canRead)
+	api.POST("/payments/:id/capture", paymentController.CapturePayment, canWrite, idempotent)
+	api.POST("/payments/:id/void", paymentController.VoidPayment, canWrite, idempotent)
+	api.POST("/payments/:id/refunds", paymentController.RefundPayment, canRefund, idempotent)
+	api.GET("/payments/:id/refunds", paymentController.GetRefunds, canRead)
+
+	// With PAYMENT_TLS_CLIENT_CA_FILE set, only callers holding a certificate from
+	// that CA, such as the shopping service, can connect at all
+	tlsConfig, err := tlsutil.ServerConfig(cfg.Server.TLS)
+	if err != nil {
+		log.Fatal("Failed to configure TLS:", err)
+	}
+	server := &http.Server{Addr: ":" + cfg.Server.Port, TLSConfig: tlsConfig}
+
+	log.Printf("✓ Payment Service running on port %s (TLS: %t, client certificates: %t)", cfg.Server.Port, tlsConfig != nil, cfg.Server.TLS.ClientCAFile != "")
+	e.Logger.Fatal(e.StartServer(server))
+}
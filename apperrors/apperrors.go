@@ -0,0 +1,99 @@
+// Package apperrors defines the typed errors shared by the services of both
+// servers. Services return *Error values, usually package level sentinels that
+// may be wrapped with fmt.Errorf and %w for detail, and the HTTP layer turns
+// their Kind into a status code and their Code into the machine-readable code
+// of the error response.
+package apperrors
+
+import "errors"
+
+// Kind classifies an error independently of the transport.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindInvalidArgument
+	KindNotFound
+	KindConflict
+	// KindUnprocessable is a well-formed request that breaks a business rule
+	KindUnprocessable
+	// KindUpstreamUnavailable is a dependency, such as the payment service,
+	// that could not be reached or answered with an unexpected error
+	KindUpstreamUnavailable
+	// KindUnauthenticated is a request without valid credentials
+	KindUnauthenticated
+	// KindForbidden is an authenticated caller without the needed permission
+	KindForbidden
+)
+
+// CodeInternal is the code of errors that carry no *Error.
+const CodeInternal = "internal_error"
+
+// Error is a domain error with a kind and a stable, machine-readable code.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	// Err is the underlying cause, if any
+	Err error
+}
+
+func (e *Error) Error() string { return e.Message }
+func (e *Error) Unwrap() error { return e.Err }
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func InvalidArgument(code, message string) *Error {
+	return New(KindInvalidArgument, code, message)
+}
+
+func NotFound(code, message string) *Error {
+	return New(KindNotFound, code, message)
+}
+
+func Conflict(code, message string) *Error {
+	return New(KindConflict, code, message)
+}
+
+func Unprocessable(code, message string) *Error {
+	return New(KindUnprocessable, code, message)
+}
+
+func UpstreamUnavailable(code, message string) *Error {
+	return New(KindUpstreamUnavailable, code, message)
+}
+
+func Unauthenticated(code, message string) *Error {
+	return New(KindUnauthenticated, code, message)
+}
+
+func Forbidden(code, message string) *Error {
+	return New(KindForbidden, code, message)
+}
+
+// Wrap classifies an error from outside the domain, keeping its message.
+func Wrap(kind Kind, code string, err error) *Error {
+	return &Error{Kind: kind, Code: code, Message: err.Error(), Err: err}
+}
+
+// KindOf returns the kind of the first *Error in err's chain, or
+// KindInternal if there is none.
+func KindOf(err error) Kind {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Kind
+	}
+	return KindInternal
+}
+
+// CodeOf returns the code of the first *Error in err's chain, or
+// CodeInternal if there is none.
+func CodeOf(err error) string {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Code
+	}
+	return CodeInternal
+}
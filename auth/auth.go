@@ -0,0 +1,39 @@
+// Package auth issues and verifies the JWT bearer tokens of the shopping
+// service and carries the authenticated caller through request contexts.
+package auth
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the claims of a shopping service access token. The subject is
+// the user's ID, or the name of the calling service.
+type Claims struct {
+	Username string `json:"username,omitempty"`
+	Role     string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+type claimsKey struct{}
+
+// WithClaims returns a copy of ctx that carries the caller's claims.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFrom returns the claims of the authenticated caller, if any.
+func ClaimsFrom(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// Subject returns the subject of the authenticated caller, or "" for an
+// unauthenticated context such as a background worker.
+func Subject(ctx context.Context) string {
+	if claims, ok := ClaimsFrom(ctx); ok {
+		return claims.Subject
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// AuthConfig holds the keys bearer tokens are signed and verified with. HS256
+// tokens use Secret; RS256 tokens are verified against the public keys in
+// JWKSFile, picked by the token's kid.
+type AuthConfig struct {
+	Secret   string
+	JWKSFile string
+	// PrivateKeyFile is a PEM RSA key; when set, login issues RS256 tokens
+	// signed with it under KeyID instead of HS256 tokens
+	PrivateKeyFile string
+	KeyID          string
+	Issuer         string
+	TokenTTL       time.Duration
+	// AdminUsername and AdminPassword, when both set, create the first user
+	// on startup if it does not exist yet
+	AdminUsername string
+	AdminPassword string
+	// Roles maps each role to the permissions it grants. It is read from the
+	// JSON file at RBAC_POLICY_FILE, or DefaultRoles when that is not set.
+	Roles map[string][]string
+}
+
+// DefaultRoles is the role to permission mapping used without a policy file.
+var DefaultRoles = map[string][]string{
+	"admin": {
+		"products:read", "products:write", "products:delete", "stock:read", "stock:write",
+		"reservations:read", "reservations:read_all", "reservations:write",
+		"transactions:create", "transactions:read", "transactions:read_all", "transactions:update",
+		"transactions:cancel", "transactions:refund", "transactions:delete",
+		"orders:create", "orders:read", "orders:read_all", "carts:write", "carts:read_all", "users:write",
+		"payments:read", "payments:refund",
+	},
+	"staff": {
+		"products:read", "stock:read",
+		"reservations:read", "reservations:read_all", "reservations:write",
+		"transactions:create", "transactions:read", "transactions:read_all", "transactions:update",
+		"transactions:cancel", "transactions:refund",
+		"orders:create", "orders:read", "orders:read_all", "carts:write", "carts:read_all",
+		"payments:read",
+	},
+	"customer": {
+		"products:read",
+		"reservations:read", "reservations:write",
+		"transactions:create", "transactions:read", "transactions:cancel",
+		"orders:create", "orders:read", "carts:write",
+	},
+	// service is the role of the shopping service when it calls the payment service
+	"service": {
+		"payments:read", "payments:write", "payments:refund",
+	},
+}
+
+func setAuthDefaults() {
+	viper.SetDefault("JWT_ISSUER", "shopping-service")
+	viper.SetDefault("JWT_TOKEN_TTL", "1h")
+}
+
+func loadAuth() (AuthConfig, error) {
+	cfg := AuthConfig{
+		Secret:         viper.GetString("JWT_SECRET"),
+		JWKSFile:       viper.GetString("JWT_JWKS_FILE"),
+		PrivateKeyFile: viper.GetString("JWT_PRIVATE_KEY_FILE"),
+		KeyID:          viper.GetString("JWT_KEY_ID"),
+		Issuer:         viper.GetString("JWT_ISSUER"),
+		TokenTTL:       viper.GetDuration("JWT_TOKEN_TTL"),
+		AdminUsername:  viper.GetString("AUTH_ADMIN_USERNAME"),
+		AdminPassword:  viper.GetString("AUTH_ADMIN_PASSWORD"),
+		Roles:          DefaultRoles,
+	}
+
+	if path := viper.GetString("RBAC_POLICY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read RBAC policy: %w", err)
+		}
+		var roles map[string][]string
+		if err := json.Unmarshal(data, &roles); err != nil {
+			return cfg, fmt.Errorf("invalid RBAC policy %s: %w", path, err)
+		}
+		cfg.Roles = roles
+	}
+	return cfg, nil
+}
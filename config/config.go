@@ -4,6 +4,7 @@ import (
 	"errors"
 	"log"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -12,19 +13,123 @@ type Config struct {
 	Server         ServerConfig
 	Database       DatabaseConfig
 	PaymentService PaymentServiceConfig
+	Idempotency    IdempotencyConfig
+	Outbox         OutboxConfig
+	Reservation    ReservationConfig
+	Cart           CartConfig
+	Purge          PurgeConfig
+	Auth           AuthConfig
+}
+
+type PurgeConfig struct {
+	// Retention is how long soft deleted records are kept before they are purged
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+type CartConfig struct {
+	// TTL is how long a cart is kept after its last change
+	TTL time.Duration
+}
+
+type ReservationConfig struct {
+	// TTL is used when a reservation does not ask for one, and for the
+	// reservations transactions make for themselves
+	TTL           time.Duration
+	MaxTTL        time.Duration
+	SweepInterval time.Duration
+	// MaxQuantityPerCustomer caps how many units of one product a customer
+	// may hold in active reservations at once
+	MaxQuantityPerCustomer int64
+}
+
+type OutboxConfig struct {
+	PollInterval time.Duration
+	// LockTimeout is how long a claimed entry stays invisible to other workers
+	LockTimeout time.Duration
+	MaxAttempts int
+}
+
+type IdempotencyConfig struct {
+	// Retention is how long a stored response can be replayed for its key
+	Retention time.Duration
+	// LockTimeout is how long a key stays claimed by a request that has not
+	// finished; a retry after that may take over the key. It must outlast the
+	// slowest request.
+	LockTimeout time.Duration
 }
 
 type PaymentServiceConfig struct {
 	BaseURI string
+	// Timeout applies to each attempt, not to the call including retries
+	Timeout        time.Duration
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	MaxIdleConns   int
+	// The breaker opens after this many consecutive failures; 0 disables it
+	BreakerFailureThreshold int
+	BreakerCooldown         time.Duration
+	// SigningSecret signs every request to the payment service; it must
+	// match the payment service's PAYMENT_SIGNING_SECRET
+	SigningSecret string
+	// CAFile verifies the payment service's certificate instead of the
+	// system roots; ClientCertFile and ClientKeyFile are presented when the
+	// payment service requires client certificates
+	CAFile         string
+	ClientCertFile string
+	ClientKeyFile  string
 }
 
 type ServerConfig struct {
 	Port string
+	TLS  TLSConfig
+}
+
+// TLSConfig makes a server listen with TLS when CertFile and KeyFile are set.
+// Each server reads its own files (SHOPPING_TLS_* or PAYMENT_TLS_*), so both
+// can run from one environment with different certificates.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile, when set, makes the server require client certificates
+	// signed by this CA
+	ClientCAFile string
 }
 
 type DatabaseConfig struct {
 	MongoURI string
 	DBName   string
+	Timeouts TimeoutConfig
+}
+
+// TimeoutConfig bounds each kind of database operation. A shorter deadline on
+// the caller's context, such as a client going away, still wins.
+type TimeoutConfig struct {
+	// Read is for single-document lookups
+	Read time.Duration
+	// Write is for inserts and updates
+	Write time.Duration
+	// List is for queries that return many documents
+	List time.Duration
+	// Maintenance is for index builds and bulk purges
+	Maintenance time.Duration
+}
+
+func setTimeoutDefaults() {
+	viper.SetDefault("DB_READ_TIMEOUT", "5s")
+	viper.SetDefault("DB_WRITE_TIMEOUT", "5s")
+	viper.SetDefault("DB_LIST_TIMEOUT", "10s")
+	viper.SetDefault("DB_MAINTENANCE_TIMEOUT", "30s")
+}
+
+func loadTimeouts() TimeoutConfig {
+	return TimeoutConfig{
+		Read:        viper.GetDuration("DB_READ_TIMEOUT"),
+		Write:       viper.GetDuration("DB_WRITE_TIMEOUT"),
+		List:        viper.GetDuration("DB_LIST_TIMEOUT"),
+		Maintenance: viper.GetDuration("DB_MAINTENANCE_TIMEOUT"),
+	}
 }
 
 func LoadConfig() (*Config, error) {
@@ -32,6 +137,27 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("PORT_SHOPPING", "9051")
 	viper.SetDefault("MONGO_URI", "mongodb://localhost:27017")
 	viper.SetDefault("SHOPPING_DB_NAME", "shopping_db")
+	viper.SetDefault("PAYMENT_SERVICE_TIMEOUT", "5s")
+	viper.SetDefault("PAYMENT_SERVICE_MAX_RETRIES", 3)
+	viper.SetDefault("PAYMENT_SERVICE_RETRY_BASE_DELAY", "200ms")
+	viper.SetDefault("PAYMENT_SERVICE_RETRY_MAX_DELAY", "2s")
+	viper.SetDefault("PAYMENT_SERVICE_MAX_IDLE_CONNS", 20)
+	viper.SetDefault("PAYMENT_SERVICE_BREAKER_THRESHOLD", 5)
+	viper.SetDefault("PAYMENT_SERVICE_BREAKER_COOLDOWN", "30s")
+	viper.SetDefault("IDEMPOTENCY_RETENTION", "24h")
+	viper.SetDefault("IDEMPOTENCY_LOCK_TIMEOUT", "1m")
+	viper.SetDefault("OUTBOX_POLL_INTERVAL", "1s")
+	viper.SetDefault("OUTBOX_LOCK_TIMEOUT", "30s")
+	viper.SetDefault("OUTBOX_MAX_ATTEMPTS", 10)
+	viper.SetDefault("RESERVATION_TTL", "15m")
+	viper.SetDefault("RESERVATION_MAX_TTL", "1h")
+	viper.SetDefault("RESERVATION_SWEEP_INTERVAL", "30s")
+	viper.SetDefault("RESERVATION_MAX_QUANTITY_PER_CUSTOMER", 100)
+	viper.SetDefault("CART_TTL", "72h")
+	viper.SetDefault("SOFT_DELETE_RETENTION", "720h")
+	viper.SetDefault("PURGE_INTERVAL", "1h")
+	setTimeoutDefaults()
+	setAuthDefaults()
 
 	// Enable automatic environment variable reading
 	viper.AutomaticEnv()
@@ -55,9 +181,40 @@ func LoadConfig() (*Config, error) {
 
 	var config Config
 	config.Server.Port = viper.GetString("PORT_SHOPPING")
+	config.Server.TLS.CertFile = viper.GetString("SHOPPING_TLS_CERT_FILE")
+	config.Server.TLS.KeyFile = viper.GetString("SHOPPING_TLS_KEY_FILE")
 	config.Database.MongoURI = viper.GetString("MONGO_URI")
 	config.Database.DBName = viper.GetString("SHOPPING_DB_NAME")
+	config.Database.Timeouts = loadTimeouts()
 	config.PaymentService.BaseURI = viper.GetString("PAYMENT_SERVICE_BASE_URI")
+	config.PaymentService.Timeout = viper.GetDuration("PAYMENT_SERVICE_TIMEOUT")
+	config.PaymentService.MaxRetries = viper.GetInt("PAYMENT_SERVICE_MAX_RETRIES")
+	config.PaymentService.RetryBaseDelay = viper.GetDuration("PAYMENT_SERVICE_RETRY_BASE_DELAY")
+	config.PaymentService.RetryMaxDelay = viper.GetDuration("PAYMENT_SERVICE_RETRY_MAX_DELAY")
+	config.PaymentService.MaxIdleConns = viper.GetInt("PAYMENT_SERVICE_MAX_IDLE_CONNS")
+	config.PaymentService.BreakerFailureThreshold = viper.GetInt("PAYMENT_SERVICE_BREAKER_THRESHOLD")
+	config.PaymentService.BreakerCooldown = viper.GetDuration("PAYMENT_SERVICE_BREAKER_COOLDOWN")
+	config.PaymentService.SigningSecret = viper.GetString("PAYMENT_SIGNING_SECRET")
+	config.PaymentService.CAFile = viper.GetString("PAYMENT_SERVICE_CA_FILE")
+	config.PaymentService.ClientCertFile = viper.GetString("PAYMENT_SERVICE_CLIENT_CERT_FILE")
+	config.PaymentService.ClientKeyFile = viper.GetString("PAYMENT_SERVICE_CLIENT_KEY_FILE")
+	config.Idempotency.Retention = viper.GetDuration("IDEMPOTENCY_RETENTION")
+	config.Idempotency.LockTimeout = viper.GetDuration("IDEMPOTENCY_LOCK_TIMEOUT")
+	config.Outbox.PollInterval = viper.GetDuration("OUTBOX_POLL_INTERVAL")
+	config.Outbox.LockTimeout = viper.GetDuration("OUTBOX_LOCK_TIMEOUT")
+	config.Outbox.MaxAttempts = viper.GetInt("OUTBOX_MAX_ATTEMPTS")
+	config.Reservation.TTL = viper.GetDuration("RESERVATION_TTL")
+	config.Reservation.MaxTTL = viper.GetDuration("RESERVATION_MAX_TTL")
+	config.Reservation.SweepInterval = viper.GetDuration("RESERVATION_SWEEP_INTERVAL")
+	config.Reservation.MaxQuantityPerCustomer = viper.GetInt64("RESERVATION_MAX_QUANTITY_PER_CUSTOMER")
+	config.Cart.TTL = viper.GetDuration("CART_TTL")
+	config.Purge.Retention = viper.GetDuration("SOFT_DELETE_RETENTION")
+	config.Purge.Interval = viper.GetDuration("PURGE_INTERVAL")
+	auth, err := loadAuth()
+	if err != nil {
+		return nil, err
+	}
+	config.Auth = auth
 
 	return &config, nil
 }
@@ -2,24 +2,42 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type PaymentConfig struct {
-	Server struct {
-		Port string
-	}
-	Database struct {
-		MongoURI string
-		DBName   string
-	}
+	Server      ServerConfig
+	Database    DatabaseConfig
+	Idempotency IdempotencyConfig
+	// Auth only needs the verification keys and roles; the payment service
+	// does not issue tokens
+	Auth    AuthConfig
+	Signing SigningConfig
+}
+
+type SigningConfig struct {
+	// Secret is shared with the shopping service, which signs every request
+	// to the payment service with it
+	Secret string
+	// MaxSkew is how far a request's timestamp may be from the server's clock
+	MaxSkew time.Duration
+	// MaxBodySize caps request bodies, which are read in full to check the
+	// signature before the caller is known; e.g. "1M"
+	MaxBodySize string
 }
 
 func LoadPaymentConfig() (*PaymentConfig, error) {
 	viper.SetDefault("PORT_PAYMENT", "9061")
 	viper.SetDefault("MONGO_URI", "mongodb://localhost:27017")
 	viper.SetDefault("PAYMENT_DB_NAME", "payment_db")
+	viper.SetDefault("IDEMPOTENCY_RETENTION", "24h")
+	viper.SetDefault("IDEMPOTENCY_LOCK_TIMEOUT", "1m")
+	viper.SetDefault("PAYMENT_SIGNING_MAX_SKEW", "5m")
+	viper.SetDefault("PAYMENT_MAX_BODY_SIZE", "1M")
+	setTimeoutDefaults()
+	setAuthDefaults()
 
 	viper.SetConfigFile(".env")
 	viper.AutomaticEnv()
@@ -28,7 +46,22 @@ func LoadPaymentConfig() (*PaymentConfig, error) {
 	}
 	cfg := &PaymentConfig{}
 	cfg.Server.Port = viper.GetString("PORT_PAYMENT")
+	cfg.Server.TLS.CertFile = viper.GetString("PAYMENT_TLS_CERT_FILE")
+	cfg.Server.TLS.KeyFile = viper.GetString("PAYMENT_TLS_KEY_FILE")
+	cfg.Server.TLS.ClientCAFile = viper.GetString("PAYMENT_TLS_CLIENT_CA_FILE")
 	cfg.Database.MongoURI = viper.GetString("MONGO_URI")
 	cfg.Database.DBName = viper.GetString("PAYMENT_DB_NAME")
+	cfg.Database.Timeouts = loadTimeouts()
+	cfg.Idempotency.Retention = viper.GetDuration("IDEMPOTENCY_RETENTION")
+	cfg.Idempotency.LockTimeout = viper.GetDuration("IDEMPOTENCY_LOCK_TIMEOUT")
+	cfg.Signing.Secret = viper.GetString("PAYMENT_SIGNING_SECRET")
+	cfg.Signing.MaxSkew = viper.GetDuration("PAYMENT_SIGNING_MAX_SKEW")
+	cfg.Signing.MaxBodySize = viper.GetString("PAYMENT_MAX_BODY_SIZE")
+
+	auth, err := loadAuth()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Auth = auth
 	return cfg, nil
 }
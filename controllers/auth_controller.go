@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"net/http"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/response"
+	"p3-graded-challenge-1-ziancarlos/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+type AuthController struct {
+	service service.AuthService
+}
+
+func NewAuthController(service service.AuthService) *AuthController {
+	return &AuthController{
+		service: service,
+	}
+}
+
+// Login godoc
+// @Summary Log in
+// @Description Exchange a username and password for a bearer token. Send it as "Authorization: Bearer <token>" on every other request.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body models.LoginRequest true "Username and password"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/login [post]
+func (ctrl *AuthController) Login(c echo.Context) error {
+	var req models.LoginRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
+	}
+
+	result, err := ctrl.service.Login(c.Request().Context(), &req)
+	if err != nil {
+		return WithMessage("Failed to log in", err)
+	}
+
+	return response.JSON(c, http.StatusOK, "Logged in successfully", result)
+}
+
+// CreateUser godoc
+// @Summary Create a user
+// @Description Create an account that can log in with the given role (admin, staff or customer, or any other role the access policy defines)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body models.UserRequest true "User data"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /users [post]
+func (ctrl *AuthController) CreateUser(c echo.Context) error {
+	var req models.UserRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
+	}
+
+	result, err := ctrl.service.CreateUser(c.Request().Context(), &req)
+	if err != nil {
+		return WithMessage("Failed to create user", err)
+	}
+
+	return response.JSON(c, http.StatusCreated, "User created successfully", result)
+}
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"net/http"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/response"
+	"p3-graded-challenge-1-ziancarlos/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+type CartController struct {
+	service service.CartService
+}
+
+func NewCartController(service service.CartService) *CartController {
+	return &CartController{
+		service: service,
+	}
+}
+
+// CreateCart godoc
+// @Summary Create a cart
+// @Description Create a server-side cart, optionally with initial items. Carts expire after a period without changes.
+// @Tags carts
+// @Accept json
+// @Produce json
+// @Param cart body models.CartRequest false "Initial items"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /carts [post]
+func (ctrl *CartController) CreateCart(c echo.Context) error {
+	var req models.CartRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
+	}
+
+	result, err := ctrl.service.CreateCart(c.Request().Context(), &req)
+	if err != nil {
+		return WithMessage("Failed to create cart", err)
+	}
+
+	return response.JSON(c, http.StatusCreated, "Cart created successfully", result)
+}
+
+// GetCart godoc
+// @Summary Get cart by ID
+// @Description Retrieve a cart with every line priced at the current catalog price. Callers without carts:read_all get 404 for carts they did not create.
+// @Tags carts
+// @Produce json
+// @Param id path string true "Cart ID"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /carts/{id} [get]
+func (ctrl *CartController) GetCart(c echo.Context) error {
+	result, err := ctrl.service.GetCart(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return WithMessage("Failed to retrieve cart", err)
+	}
+
+	return response.JSON(c, http.StatusOK, "Cart retrieved successfully", result)
+}
+
+// AddCartItem godoc
+// @Summary Add an item to a cart
+// @Description Add units of a product to the cart, merging with the product's existing line
+// @Tags carts
+// @Accept json
+// @Produce json
+// @Param id path string true "Cart ID"
+// @Param item body models.CartItemRequest true "Item to add"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /carts/{id}/items [post]
+func (ctrl *CartController) AddCartItem(c echo.Context) error {
+	var req models.CartItemRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
+	}
+
+	result, err := ctrl.service.AddItem(c.Request().Context(), c.Param("id"), &req)
+	if err != nil {
+		return WithMessage("Failed to add item", err)
+	}
+
+	return response.JSON(c, http.StatusOK, "Item added successfully", result)
+}
+
+// UpdateCartItem godoc
+// @Summary Change an item's quantity
+// @Description Set the quantity of a product already in the cart
+// @Tags carts
+// @Accept json
+// @Produce json
+// @Param id path string true "Cart ID"
+// @Param product_id path string true "Product ID"
+// @Param item body models.CartItemUpdateRequest true "New quantity"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /carts/{id}/items/{product_id} [put]
+func (ctrl *CartController) UpdateCartItem(c echo.Context) error {
+	var req models.CartItemUpdateRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
+	}
+
+	result, err := ctrl.service.UpdateItem(c.Request().Context(), c.Param("id"), c.Param("product_id"), &req)
+	if err != nil {
+		return WithMessage("Failed to update item", err)
+	}
+
+	return response.JSON(c, http.StatusOK, "Item updated successfully", result)
+}
+
+// RemoveCartItem godoc
+// @Summary Remove an item from a cart
+// @Description Remove a product's line from the cart
+// @Tags carts
+// @Produce json
+// @Param id path string true "Cart ID"
+// @Param product_id path string true "Product ID"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /carts/{id}/items/{product_id} [delete]
+func (ctrl *CartController) RemoveCartItem(c echo.Context) error {
+	result, err := ctrl.service.RemoveItem(c.Request().Context(), c.Param("id"), c.Param("product_id"))
+	if err != nil {
+		return WithMessage("Failed to remove item", err)
+	}
+
+	return response.JSON(c, http.StatusOK, "Item removed successfully", result)
+}
+
+// Checkout godoc
+// @Summary Check out a cart
+// @Description Turn the cart into an order at the current catalog prices. The order is paid in the background like any other order; poll it until its status is paid or failed.
+// @Tags carts
+// @Accept json
+// @Produce json
+// @Param Idempotency-Key header string false "Replays the original result when the request is retried with the same key"
+// @Param id path string true "Cart ID"
+// @Param checkout body models.CheckoutRequest true "Payment details"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /carts/{id}/checkout [post]
+func (ctrl *CartController) Checkout(c echo.Context) error {
+	var req models.CheckoutRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
+	}
+
+	order, err := ctrl.service.Checkout(c.Request().Context(), c.Param("id"), &req)
+	if err != nil {
+		return WithMessage("Failed to check out cart", err)
+	}
+
+	return response.JSON(c, http.StatusCreated, "Cart checked out successfully", order)
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"p3-graded-challenge-1-ziancarlos/apperrors"
+	"p3-graded-challenge-1-ziancarlos/response"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+var kindStatus = map[apperrors.Kind]int{
+	apperrors.KindInternal:            http.StatusInternalServerError,
+	apperrors.KindInvalidArgument:     http.StatusBadRequest,
+	apperrors.KindNotFound:            http.StatusNotFound,
+	apperrors.KindConflict:            http.StatusConflict,
+	apperrors.KindUnprocessable:       http.StatusUnprocessableEntity,
+	apperrors.KindUpstreamUnavailable: http.StatusBadGateway,
+	apperrors.KindUnauthenticated:     http.StatusUnauthorized,
+	apperrors.KindForbidden:           http.StatusForbidden,
+}
+
+// messageError carries the human-readable summary of a failed operation to
+// HTTPErrorHandler alongside the error itself.
+type messageError struct {
+	message string
+	err     error
+}
+
+func (e *messageError) Error() string { return e.err.Error() }
+func (e *messageError) Unwrap() error { return e.err }
+
+// WithMessage sets the message of the error response for err, e.g.
+// "Failed to create transaction". The status and code still come from err.
+func WithMessage(message string, err error) error {
+	return &messageError{message: message, err: err}
+}
+
+func invalidBody(err error) error {
+	return WithMessage("Invalid request body", apperrors.Wrap(apperrors.KindInvalidArgument, "invalid_body", err))
+}
+
+func invalidQuery(err error) error {
+	return WithMessage("Invalid query parameters", apperrors.Wrap(apperrors.KindInvalidArgument, "invalid_query", err))
+}
+
+func validationFailed(err error) error {
+	return WithMessage("Validation failed", apperrors.Wrap(apperrors.KindInvalidArgument, "validation_failed", err))
+}
+
+// HTTPErrorHandler writes every error returned by a handler or middleware as
+// a response.Error, with the status taken from the error's apperrors kind.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status, body := errorResponse(err)
+	if status >= http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = response.Fail(c, status, body)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+func errorResponse(err error) (int, response.Error) {
+	var (
+		appErr         *apperrors.Error
+		validationErrs validator.ValidationErrors
+		httpErr        *echo.HTTPError
+	)
+
+	status := http.StatusInternalServerError
+	body := response.Error{Code: apperrors.CodeInternal, Error: err.Error()}
+	switch {
+	case errors.As(err, &appErr):
+		status = kindStatus[appErr.Kind]
+		body.Code = appErr.Code
+	case errors.As(err, &validationErrs):
+		status = http.StatusBadRequest
+		body.Code = "validation_failed"
+	case errors.As(err, &httpErr):
+		// Routing errors and errors from Echo's own middleware
+		status = httpErr.Code
+		body.Code = strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+		body.Error = fmt.Sprint(httpErr.Message)
+	}
+
+	if errors.As(err, &validationErrs) {
+		body.Errors = toFieldErrors(validationErrs)
+		messages := make([]string, len(body.Errors))
+		for i, field := range body.Errors {
+			messages[i] = field.Message
+		}
+		body.Error = strings.Join(messages, "; ")
+	}
+
+	var withMessage *messageError
+	if errors.As(err, &withMessage) {
+		body.Message = withMessage.message
+	} else {
+		body.Message = http.StatusText(status)
+	}
+
+	return status, body
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"net/http"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/response"
+	"p3-graded-challenge-1-ziancarlos/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+type OrderController struct {
+	service service.OrderService
+}
+
+func NewOrderController(service service.OrderService) *OrderController {
+	return &OrderController{
+		service: service,
+	}
+}
+
+// CreateOrder godoc
+// @Summary Create a new order
+// @Description Create a pending order with one or more line items, all priced in the same currency. Every line's units are reserved from stock and the total is charged as a single payment in the background; poll the order until its status is paid or failed.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param Idempotency-Key header string false "Replays the original result when the request is retried with the same key"
+// @Param order body models.OrderRequest true "Order data"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /orders [post]
+func (ctrl *OrderController) CreateOrder(c echo.Context) error {
+	var req models.OrderRequest
+
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
+	}
+
+	result, err := ctrl.service.CreateOrder(c.Request().Context(), &req)
+	if err != nil {
+		return WithMessage("Failed to create order", err)
+	}
+
+	return response.JSON(c, http.StatusCreated, "Order created successfully", result)
+}
+
+// GetAllOrders godoc
+// @Summary Get all orders
+// @Description Retrieve orders newest first. Pass meta.next_cursor back as cursor to get the next page. Callers without orders:read_all, such as customers, only see the orders they created.
+// @Tags orders
+// @Produce json
+// @Param status query string false "Filter by status" Enums(pending, paid, failed)
+// @Param from query string false "Only orders created on or after this time (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Only orders created before this time (RFC 3339 or YYYY-MM-DD)"
+// @Param cursor query string false "Opaque cursor from a previous page"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /orders [get]
+func (ctrl *OrderController) GetAllOrders(c echo.Context) error {
+	var query models.OrderQuery
+
+	if err := c.Bind(&query); err != nil {
+		return invalidQuery(err)
+	}
+
+	if err := c.Validate(&query); err != nil {
+		return validationFailed(err)
+	}
+
+	result, meta, err := ctrl.service.GetAllOrders(c.Request().Context(), &query)
+	if err != nil {
+		return WithMessage("Failed to retrieve orders", err)
+	}
+
+	return response.Page(c, http.StatusOK, "Orders retrieved successfully", result, meta)
+}
+
+// GetOrderByID godoc
+// @Summary Get order by ID
+// @Description Retrieve an order with its line items by its ID. Callers without orders:read_all get 404 for orders they did not create.
+// @Tags orders
+// @Produce json
+// @Param id path string true "Order ID"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /orders/{id} [get]
+func (ctrl *OrderController) GetOrderByID(c echo.Context) error {
+	result, err := ctrl.service.GetOrderByID(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return WithMessage("Failed to retrieve order", err)
+	}
+
+	return response.JSON(c, http.StatusOK, "Order retrieved successfully", result)
+}
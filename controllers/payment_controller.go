@@ -3,6 +3,7 @@ package controllers
 import (
 	"net/http"
 	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/response"
 	"p3-graded-challenge-1-ziancarlos/service"
 
 	"github.com/labstack/echo/v4"
@@ -13,27 +14,197 @@ type PaymentController struct {
 }
 
 func NewPaymentController(service service.PaymentService) *PaymentController {
-	return &PaymentController{service: service}
+	return &PaymentController{
+		service: service,
+	}
 }
 
 // CreatePayment godoc
-// @Summary Create a new payment
-// @Description Add a new payment to the database
+// @Summary Authorize a new payment
+// @Description Authorize a payment; it must later be captured or voided
 // @Tags payments
 // @Accept json
 // @Produce json
-// @Param payment body models.PaymentRequest true "Payment data (amount)"
-// @Success 201 {object} models.PaymentResponse
-// @Failure 400 {object} map[string]string
+// @Param Idempotency-Key header string false "Replays the original result when the request is retried with the same key"
+// @Param payment body models.PaymentRequest true "Payment data (amount, optional currency, transaction_id or order_id)"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
 // @Router /payments [post]
 func (ctrl *PaymentController) CreatePayment(c echo.Context) error {
 	var req models.PaymentRequest
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return invalidBody(err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
+	}
+	resp, err := ctrl.service.CreatePayment(c.Request().Context(), &req)
+	if err != nil {
+		return err
+	}
+	return response.JSON(c, http.StatusCreated, "Payment authorized successfully", resp)
+}
+
+// GetAllPayments godoc
+// @Summary Get all payments
+// @Description Retrieve payments newest first with pagination and filters
+// @Tags payments
+// @Produce json
+// @Param page query int false "Page number (starts at 1)"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param from query string false "Created on or after this time (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Created before this time (RFC 3339 or YYYY-MM-DD)"
+// @Param min_amount query number false "Minimum amount"
+// @Param max_amount query number false "Maximum amount"
+// @Param status query string false "Payment status"
+// @Param transaction_id query string false "Originating shopping transaction ID"
+// @Param order_id query string false "Originating shopping order ID"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /payments [get]
+func (ctrl *PaymentController) GetAllPayments(c echo.Context) error {
+	var query models.PaymentQuery
+	if err := c.Bind(&query); err != nil {
+		return invalidQuery(err)
+	}
+	if err := c.Validate(&query); err != nil {
+		return validationFailed(err)
+	}
+	payments, meta, err := ctrl.service.GetAllPayments(c.Request().Context(), &query)
+	if err != nil {
+		return err
+	}
+	return response.Page(c, http.StatusOK, "Payments retrieved successfully", payments, meta)
+}
+
+// GetPaymentByID godoc
+// @Summary Get payment by ID
+// @Description Retrieve a payment by its ID
+// @Tags payments
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Security BearerAuth
+// @Router /payments/{id} [get]
+func (ctrl *PaymentController) GetPaymentByID(c echo.Context) error {
+	resp, err := ctrl.service.GetPaymentByID(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return response.JSON(c, http.StatusOK, "Payment retrieved successfully", resp)
+}
+
+// CapturePayment godoc
+// @Summary Capture a payment
+// @Description Settle an authorized payment. Capturing an already captured payment succeeds without changes.
+// @Tags payments
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /payments/{id}/capture [post]
+func (ctrl *PaymentController) CapturePayment(c echo.Context) error {
+	resp, err := ctrl.service.CapturePayment(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return response.JSON(c, http.StatusOK, "Payment captured successfully", resp)
+}
+
+// VoidPayment godoc
+// @Summary Void a payment
+// @Description Cancel an authorized payment. Voiding an already voided payment succeeds without changes.
+// @Tags payments
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /payments/{id}/void [post]
+func (ctrl *PaymentController) VoidPayment(c echo.Context) error {
+	resp, err := ctrl.service.VoidPayment(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return response.JSON(c, http.StatusOK, "Payment voided successfully", resp)
+}
+
+// RefundPayment godoc
+// @Summary Refund a payment
+// @Description Refund part or all of a captured payment. Omit amount to refund everything left.
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Param Idempotency-Key header string false "Replays the original result when the request is retried with the same key"
+// @Param refund body models.RefundRequest false "Refund data"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 422 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /payments/{id}/refunds [post]
+func (ctrl *PaymentController) RefundPayment(c echo.Context) error {
+	var req models.RefundRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
 	}
-	resp, err := ctrl.service.CreatePayment(&req)
+	resp, err := ctrl.service.RefundPayment(c.Request().Context(), c.Param("id"), &req)
+	if err != nil {
+		return err
+	}
+	return response.JSON(c, http.StatusCreated, "Payment refunded successfully", resp)
+}
+
+// GetRefunds godoc
+// @Summary List refunds of a payment
+// @Description Retrieve every refund recorded against a payment, oldest first
+// @Tags payments
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /payments/{id}/refunds [get]
+func (ctrl *PaymentController) GetRefunds(c echo.Context) error {
+	resp, err := ctrl.service.GetRefunds(c.Request().Context(), c.Param("id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return err
 	}
-	return c.JSON(http.StatusCreated, resp)
+	return response.JSON(c, http.StatusOK, "Refunds retrieved successfully", resp)
 }
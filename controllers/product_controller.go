@@ -3,32 +3,30 @@ package controllers
 import (
 	"net/http"
 	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/response"
 	"p3-graded-challenge-1-ziancarlos/service"
+	"strconv"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 )
 
 type ProductController struct {
-	service   service.ProductService
-	validator *validator.Validate
+	service service.ProductService
 }
 
 func NewProductController(service service.ProductService) *ProductController {
 	return &ProductController{
-		service:   service,
-		validator: validator.New(),
+		service: service,
 	}
 }
 
-type ErrorResponse struct {
-	Message string `json:"message"`
-	Error   string `json:"error,omitempty"`
-}
-
-type SuccessResponse struct {
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+// parseIncludeDeleted reads the admin include_deleted flag of a lookup by ID.
+func parseIncludeDeleted(c echo.Context) (bool, error) {
+	value := c.QueryParam("include_deleted")
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
 }
 
 // CreateProduct godoc
@@ -38,62 +36,69 @@ type SuccessResponse struct {
 // @Accept json
 // @Produce json
 // @Param product body models.ProductRequest true "Product data"
-// @Success 201 {object} SuccessResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
 // @Router /products [post]
 func (ctrl *ProductController) CreateProduct(c echo.Context) error {
 	var req models.ProductRequest
 
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: "Invalid request body",
-			Error:   err.Error(),
-		})
+		return invalidBody(err)
 	}
 
-	if err := ctrl.validator.Struct(req); err != nil {
-		return c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: "Validation failed",
-			Error:   err.Error(),
-		})
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
 	}
 
-	response, err := ctrl.service.CreateProduct(&req)
+	result, err := ctrl.service.CreateProduct(c.Request().Context(), &req)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Message: "Failed to create product",
-			Error:   err.Error(),
-		})
+		return WithMessage("Failed to create product", err)
 	}
 
-	return c.JSON(http.StatusCreated, SuccessResponse{
-		Message: "Product created successfully",
-		Data:    response,
-	})
+	return response.JSON(c, http.StatusCreated, "Product created successfully", result)
 }
 
 // GetAllProducts godoc
 // @Summary Get all products
-// @Description Retrieve all products from the database
+// @Description Retrieve products with pagination, filtering and sorting. Use either page or the after cursor (only with the default sort).
 // @Tags products
 // @Produce json
-// @Success 200 {object} SuccessResponse
-// @Failure 500 {object} ErrorResponse
+// @Param page query int false "Page number (starts at 1)"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param after query string false "Return products after this product ID"
+// @Param name query string false "Case-insensitive name filter"
+// @Param min_price query number false "Minimum price"
+// @Param max_price query number false "Maximum price"
+// @Param sort query string false "Sort order" Enums(price, -price, name)
+// @Param include_deleted query bool false "Also return soft deleted products (admin)"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
 // @Router /products [get]
 func (ctrl *ProductController) GetAllProducts(c echo.Context) error {
-	response, err := ctrl.service.GetAllProducts()
+	var query models.ProductQuery
+
+	if err := c.Bind(&query); err != nil {
+		return invalidQuery(err)
+	}
+
+	if err := c.Validate(&query); err != nil {
+		return validationFailed(err)
+	}
+
+	result, meta, err := ctrl.service.GetAllProducts(c.Request().Context(), &query)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Message: "Failed to retrieve products",
-			Error:   err.Error(),
-		})
+		return WithMessage("Failed to retrieve products", err)
 	}
 
-	return c.JSON(http.StatusOK, SuccessResponse{
-		Message: "Products retrieved successfully",
-		Data:    response,
-	})
+	return response.Page(c, http.StatusOK, "Products retrieved successfully", result, meta)
 }
 
 // GetProductByID godoc
@@ -102,89 +107,186 @@ func (ctrl *ProductController) GetAllProducts(c echo.Context) error {
 // @Tags products
 // @Produce json
 // @Param id path string true "Product ID"
-// @Success 200 {object} SuccessResponse
-// @Failure 404 {object} ErrorResponse
+// @Param include_deleted query bool false "Also return a soft deleted product (admin)"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
 // @Router /products/{id} [get]
 func (ctrl *ProductController) GetProductByID(c echo.Context) error {
 	id := c.Param("id")
 
-	response, err := ctrl.service.GetProductByID(id)
+	includeDeleted, err := parseIncludeDeleted(c)
+	if err != nil {
+		return invalidQuery(err)
+	}
+
+	result, err := ctrl.service.GetProductByID(c.Request().Context(), id, includeDeleted)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, ErrorResponse{
-			Message: "Product not found",
-			Error:   err.Error(),
-		})
+		return WithMessage("Failed to retrieve product", err)
 	}
 
-	return c.JSON(http.StatusOK, SuccessResponse{
-		Message: "Product retrieved successfully",
-		Data:    response,
-	})
+	return response.JSON(c, http.StatusOK, "Product retrieved successfully", result)
 }
 
 // UpdateProduct godoc
 // @Summary Update a product
-// @Description Update an existing product by its ID
+// @Description Update the name and price of an existing product by its ID. Stock is ignored; use the stock endpoint.
 // @Tags products
 // @Accept json
 // @Produce json
 // @Param id path string true "Product ID"
 // @Param product body models.ProductRequest true "Product data"
-// @Success 200 {object} SuccessResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
 // @Router /products/{id} [put]
 func (ctrl *ProductController) UpdateProduct(c echo.Context) error {
 	id := c.Param("id")
 
 	var req models.ProductRequest
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: "Invalid request body",
-			Error:   err.Error(),
-		})
+		return invalidBody(err)
 	}
 
-	if err := ctrl.validator.Struct(req); err != nil {
-		return c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: "Validation failed",
-			Error:   err.Error(),
-		})
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
 	}
 
-	if err := ctrl.service.UpdateProduct(id, &req); err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Message: "Failed to update product",
-			Error:   err.Error(),
-		})
+	if err := ctrl.service.UpdateProduct(c.Request().Context(), id, &req); err != nil {
+		return WithMessage("Failed to update product", err)
 	}
 
-	return c.JSON(http.StatusOK, SuccessResponse{
-		Message: "Product updated successfully",
-	})
+	return response.JSON(c, http.StatusOK, "Product updated successfully", nil)
 }
 
 // DeleteProduct godoc
 // @Summary Delete a product
-// @Description Delete a product by its ID
+// @Description Soft delete a product by its ID. It can be restored until the retention period ends and it is purged. A product that transactions or orders point at is refused with 409 unless force=true (admin) is given with a reason, which archives it so it is never purged.
 // @Tags products
 // @Produce json
 // @Param id path string true "Product ID"
-// @Success 200 {object} SuccessResponse
-// @Failure 500 {object} ErrorResponse
+// @Param force query bool false "Archive the product even though transactions or orders point at it (admin)"
+// @Param reason query string false "Why the delete was forced; required with force"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
 // @Router /products/{id} [delete]
 func (ctrl *ProductController) DeleteProduct(c echo.Context) error {
 	id := c.Param("id")
 
-	if err := ctrl.service.DeleteProduct(id); err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Message: "Failed to delete product",
-			Error:   err.Error(),
-		})
+	var query models.ProductDeleteQuery
+	if err := c.Bind(&query); err != nil {
+		return invalidQuery(err)
+	}
+
+	if err := c.Validate(&query); err != nil {
+		return validationFailed(err)
+	}
+
+	if err := ctrl.service.DeleteProduct(c.Request().Context(), id, &query); err != nil {
+		return WithMessage("Failed to delete product", err)
+	}
+
+	return response.JSON(c, http.StatusOK, "Product deleted successfully", nil)
+}
+
+// RestoreProduct godoc
+// @Summary Restore a deleted product
+// @Description Undo the soft delete of a product that has not been purged yet
+// @Tags products
+// @Produce json
+// @Param id path string true "Product ID"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /products/{id}/restore [post]
+func (ctrl *ProductController) RestoreProduct(c echo.Context) error {
+	id := c.Param("id")
+
+	result, err := ctrl.service.RestoreProduct(c.Request().Context(), id)
+	if err != nil {
+		return WithMessage("Failed to restore product", err)
+	}
+
+	return response.JSON(c, http.StatusOK, "Product restored successfully", result)
+}
+
+// AdjustStock godoc
+// @Summary Adjust product stock
+// @Description Add units to (positive quantity) or remove units from (negative quantity) a product's stock with a reason code. Stock never goes below zero.
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path string true "Product ID"
+// @Param adjustment body models.StockAdjustmentRequest true "Stock adjustment"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /products/{id}/stock [post]
+func (ctrl *ProductController) AdjustStock(c echo.Context) error {
+	id := c.Param("id")
+
+	var req models.StockAdjustmentRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
 	}
 
-	return c.JSON(http.StatusOK, SuccessResponse{
-		Message: "Product deleted successfully",
-	})
+	adjustment, err := ctrl.service.AdjustStock(c.Request().Context(), id, &req)
+	if err != nil {
+		return WithMessage("Failed to adjust stock", err)
+	}
+
+	return response.JSON(c, http.StatusCreated, "Stock adjusted successfully", adjustment)
 }
 
+// GetStockAdjustments godoc
+// @Summary List stock adjustments
+// @Description Retrieve the stock adjustment history of a product, newest first
+// @Tags products
+// @Produce json
+// @Param id path string true "Product ID"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /products/{id}/stock [get]
+func (ctrl *ProductController) GetStockAdjustments(c echo.Context) error {
+	id := c.Param("id")
+
+	adjustments, err := ctrl.service.GetStockAdjustments(c.Request().Context(), id)
+	if err != nil {
+		return WithMessage("Failed to retrieve stock adjustments", err)
+	}
+
+	return response.JSON(c, http.StatusOK, "Stock adjustments retrieved successfully", adjustments)
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"net/http"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/response"
+	"p3-graded-challenge-1-ziancarlos/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ReservationController struct {
+	service service.ReservationService
+}
+
+func NewReservationController(service service.ReservationService) *ReservationController {
+	return &ReservationController{
+		service: service,
+	}
+}
+
+// CreateReservation godoc
+// @Summary Reserve product stock
+// @Description Hold units of a product while the buyer checks out. The units leave the available stock until the reservation is used by a transaction, released, or expires. A customer can hold at most RESERVATION_MAX_QUANTITY_PER_CUSTOMER units of one product at a time; going over it is refused with 409.
+// @Tags reservations
+// @Accept json
+// @Produce json
+// @Param id path string true "Product ID"
+// @Param reservation body models.ReservationRequest true "Reservation data"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /products/{id}/reservations [post]
+func (ctrl *ReservationController) CreateReservation(c echo.Context) error {
+	id := c.Param("id")
+
+	var req models.ReservationRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
+	}
+
+	reservation, err := ctrl.service.CreateReservation(c.Request().Context(), id, &req)
+	if err != nil {
+		return WithMessage("Failed to create reservation", err)
+	}
+
+	return response.JSON(c, http.StatusCreated, "Reservation created successfully", reservation)
+}
+
+// GetReservation godoc
+// @Summary Get reservation by ID
+// @Description Retrieve a stock reservation by its ID. Callers without reservations:read_all get 404 for reservations they did not make.
+// @Tags reservations
+// @Produce json
+// @Param id path string true "Reservation ID"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /reservations/{id} [get]
+func (ctrl *ReservationController) GetReservation(c echo.Context) error {
+	reservation, err := ctrl.service.GetReservation(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return WithMessage("Failed to retrieve reservation", err)
+	}
+
+	return response.JSON(c, http.StatusOK, "Reservation retrieved successfully", reservation)
+}
+
+// ReleaseReservation godoc
+// @Summary Release a reservation
+// @Description Return the units of an active reservation to the available stock. Reservations already used by a transaction cannot be released.
+// @Tags reservations
+// @Produce json
+// @Param id path string true "Reservation ID"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /reservations/{id} [delete]
+func (ctrl *ReservationController) ReleaseReservation(c echo.Context) error {
+	reservation, err := ctrl.service.ReleaseReservation(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return WithMessage("Failed to release reservation", err)
+	}
+
+	return response.JSON(c, http.StatusOK, "Reservation released successfully", reservation)
+}
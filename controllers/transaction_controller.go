@@ -3,178 +3,288 @@ package controllers
 import (
 	"net/http"
 	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/response"
 	"p3-graded-challenge-1-ziancarlos/service"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 )
 
 type TransactionController struct {
-	service   service.TransactionService
-	validator *validator.Validate
+	service service.TransactionService
 }
 
 func NewTransactionController(service service.TransactionService) *TransactionController {
 	return &TransactionController{
-		service:   service,
-		validator: validator.New(),
+		service: service,
 	}
 }
 
 // CreateTransaction godoc
 // @Summary Create a new transaction
-// @Description Add a new transaction to the database
+// @Description Create a pending transaction for quantity units (default 1), reserving them from stock, or for the units of an existing reservation_id. The payment is made in the background; poll the transaction until its status is paid or failed. Units are returned to stock if the payment fails.
 // @Tags transactions
 // @Accept json
 // @Produce json
-// @Param transaction body models.TransactionRequest true "Transaction data (must include product_id)"
-// @Success 201 {object} SuccessResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Param Idempotency-Key header string false "Replays the original result when the request is retried with the same key"
+// @Param transaction body models.TransactionRequest true "Transaction data (must include product_id; price is taken from the catalog)"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
 // @Router /transactions [post]
 func (ctrl *TransactionController) CreateTransaction(c echo.Context) error {
 	var req models.TransactionRequest
 
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: "Invalid request body",
-			Error:   err.Error(),
-		})
+		return invalidBody(err)
 	}
 
-	if err := ctrl.validator.Struct(req); err != nil {
-		return c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: "Validation failed",
-			Error:   err.Error(),
-		})
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
 	}
 
-	response, err := ctrl.service.CreateTransaction(&req)
+	result, err := ctrl.service.CreateTransaction(c.Request().Context(), &req)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Message: "Failed to create transaction",
-			Error:   err.Error(),
-		})
+		return WithMessage("Failed to create transaction", err)
 	}
 
-	return c.JSON(http.StatusCreated, SuccessResponse{
-		Message: "Transaction created successfully",
-		Data:    response,
-	})
+	return response.JSON(c, http.StatusCreated, "Transaction created successfully", result)
 }
 
 // GetAllTransactions godoc
 // @Summary Get all transactions
-// @Description Retrieve all transactions from the database
+// @Description Retrieve transactions newest first. Pass meta.next_cursor back as cursor to get the next page. Callers without transactions:read_all, such as customers, only see the transactions they created.
 // @Tags transactions
 // @Produce json
-// @Success 200 {object} SuccessResponse
-// @Failure 500 {object} ErrorResponse
+// @Param product_id query string false "Filter by product ID"
+// @Param payment_method query string false "Filter by payment method"
+// @Param from query string false "Only transactions on or after this time (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Only transactions before this time (RFC 3339 or YYYY-MM-DD)"
+// @Param min_price query number false "Minimum price"
+// @Param max_price query number false "Maximum price"
+// @Param cursor query string false "Opaque cursor from a previous page"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param include_deleted query bool false "Also return soft deleted transactions (admin)"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
 // @Router /transactions [get]
 func (ctrl *TransactionController) GetAllTransactions(c echo.Context) error {
-	response, err := ctrl.service.GetAllTransactions()
+	var query models.TransactionQuery
+
+	if err := c.Bind(&query); err != nil {
+		return invalidQuery(err)
+	}
+
+	if err := c.Validate(&query); err != nil {
+		return validationFailed(err)
+	}
+
+	result, meta, err := ctrl.service.GetAllTransactions(c.Request().Context(), &query)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Message: "Failed to retrieve transactions",
-			Error:   err.Error(),
-		})
+		return WithMessage("Failed to retrieve transactions", err)
 	}
 
-	return c.JSON(http.StatusOK, SuccessResponse{
-		Message: "Transactions retrieved successfully",
-		Data:    response,
-	})
+	return response.Page(c, http.StatusOK, "Transactions retrieved successfully", result, meta)
 }
 
 // GetTransactionByID godoc
 // @Summary Get transaction by ID
-// @Description Retrieve a transaction by its ID
+// @Description Retrieve a transaction by its ID. Callers without transactions:read_all get 404 for transactions they did not create.
 // @Tags transactions
 // @Produce json
 // @Param id path string true "Transaction ID"
-// @Success 200 {object} SuccessResponse
-// @Failure 404 {object} ErrorResponse
+// @Param include_deleted query bool false "Also return a soft deleted transaction (admin)"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
 // @Router /transactions/{id} [get]
 func (ctrl *TransactionController) GetTransactionByID(c echo.Context) error {
 	id := c.Param("id")
 
-	response, err := ctrl.service.GetTransactionByID(id)
+	includeDeleted, err := parseIncludeDeleted(c)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, ErrorResponse{
-			Message: "Transaction not found",
-			Error:   err.Error(),
-		})
+		return invalidQuery(err)
 	}
 
-	return c.JSON(http.StatusOK, SuccessResponse{
-		Message: "Transaction retrieved successfully",
-		Data:    response,
-	})
+	result, err := ctrl.service.GetTransactionByID(c.Request().Context(), id, includeDeleted)
+	if err != nil {
+		return WithMessage("Failed to retrieve transaction", err)
+	}
+
+	return response.JSON(c, http.StatusOK, "Transaction retrieved successfully", result)
 }
 
 // UpdateTransaction godoc
 // @Summary Update a transaction
-// @Description Update an existing transaction by its ID
+// @Description Update the fields that are safe to change in the transaction's current status. Only the payment method of a pending transaction can change; price and payment_id are always rejected. Callers without transactions:read_all get 404 for transactions they did not create.
 // @Tags transactions
 // @Accept json
 // @Produce json
 // @Param id path string true "Transaction ID"
-// @Param transaction body models.TransactionUpdateRequest true "Transaction data (can include product_id)"
-// @Success 200 {object} SuccessResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Param transaction body models.TransactionUpdateRequest true "Transaction data"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
 // @Router /transactions/{id} [put]
 func (ctrl *TransactionController) UpdateTransaction(c echo.Context) error {
 	id := c.Param("id")
 
 	var req models.TransactionUpdateRequest
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: "Invalid request body",
-			Error:   err.Error(),
-		})
+		return invalidBody(err)
 	}
 
-	if err := ctrl.validator.Struct(req); err != nil {
-		return c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: "Validation failed",
-			Error:   err.Error(),
-		})
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
 	}
 
-	if err := ctrl.service.UpdateTransaction(id, &req); err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Message: "Failed to update transaction",
-			Error:   err.Error(),
-		})
+	if err := ctrl.service.UpdateTransaction(c.Request().Context(), id, &req); err != nil {
+		return WithMessage("Failed to update transaction", err)
 	}
 
-	return c.JSON(http.StatusOK, SuccessResponse{
-		Message: "Transaction updated successfully",
-	})
+	return response.JSON(c, http.StatusOK, "Transaction updated successfully", nil)
 }
 
 // DeleteTransaction godoc
 // @Summary Delete a transaction
-// @Description Delete a transaction by its ID
+// @Description Soft delete a transaction by its ID. It can be restored until the retention period ends and it is purged. Pending transactions must be cancelled first.
 // @Tags transactions
 // @Produce json
 // @Param id path string true "Transaction ID"
-// @Success 200 {object} SuccessResponse
-// @Failure 500 {object} ErrorResponse
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
 // @Router /transactions/{id} [delete]
 func (ctrl *TransactionController) DeleteTransaction(c echo.Context) error {
 	id := c.Param("id")
 
-	if err := ctrl.service.DeleteTransaction(id); err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Message: "Failed to delete transaction",
-			Error:   err.Error(),
-		})
+	if err := ctrl.service.DeleteTransaction(c.Request().Context(), id); err != nil {
+		return WithMessage("Failed to delete transaction", err)
 	}
 
-	return c.JSON(http.StatusOK, SuccessResponse{
-		Message: "Transaction deleted successfully",
-	})
+	return response.JSON(c, http.StatusOK, "Transaction deleted successfully", nil)
 }
 
+// RestoreTransaction godoc
+// @Summary Restore a deleted transaction
+// @Description Undo the soft delete of a transaction that has not been purged yet
+// @Tags transactions
+// @Produce json
+// @Param id path string true "Transaction ID"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /transactions/{id}/restore [post]
+func (ctrl *TransactionController) RestoreTransaction(c echo.Context) error {
+	id := c.Param("id")
+
+	result, err := ctrl.service.RestoreTransaction(c.Request().Context(), id)
+	if err != nil {
+		return WithMessage("Failed to restore transaction", err)
+	}
+
+	return response.JSON(c, http.StatusOK, "Transaction restored successfully", result)
+}
+
+// RefundTransaction godoc
+// @Summary Refund a transaction
+// @Description Refund part or all of a paid transaction. Several partial refunds are allowed up to the original price; omit amount to refund everything left.
+// @Tags transactions
+// @Accept json
+// @Produce json
+// @Param id path string true "Transaction ID"
+// @Param Idempotency-Key header string false "Replays the original result when the request is retried with the same key"
+// @Param refund body models.RefundRequest false "Refund data"
+// @Success 201 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 422 {object} response.Error
+// @Failure 502 {object} response.Error
+// @Security BearerAuth
+// @Router /transactions/{id}/refunds [post]
+func (ctrl *TransactionController) RefundTransaction(c echo.Context) error {
+	id := c.Param("id")
+
+	var req models.RefundRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
+	}
+
+	result, err := ctrl.service.RefundTransaction(c.Request().Context(), id, &req, c.Request().Header.Get("Idempotency-Key"))
+	if err != nil {
+		return WithMessage("Failed to refund transaction", err)
+	}
+
+	return response.JSON(c, http.StatusCreated, "Transaction refunded successfully", result)
+}
+
+// CancelTransaction godoc
+// @Summary Cancel a transaction
+// @Description Cancel a pending transaction. Its units go back to stock and any payment already authorized for it is voided. Paid, failed and refunded transactions cannot be cancelled.
+// @Tags transactions
+// @Accept json
+// @Produce json
+// @Param id path string true "Transaction ID"
+// @Param cancel body models.TransactionCancelRequest false "Cancellation reason"
+// @Success 200 {object} response.Success
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Security BearerAuth
+// @Router /transactions/{id}/cancel [post]
+func (ctrl *TransactionController) CancelTransaction(c echo.Context) error {
+	id := c.Param("id")
+
+	var req models.TransactionCancelRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(err)
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return validationFailed(err)
+	}
+
+	result, err := ctrl.service.CancelTransaction(c.Request().Context(), id, &req)
+	if err != nil {
+		return WithMessage("Failed to cancel transaction", err)
+	}
+
+	return response.JSON(c, http.StatusOK, "Transaction cancelled successfully", result)
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"fmt"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/response"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Validator is the echo.Validator of both servers; handlers reach it through
+// c.Validate. Its validator.ValidationErrors are turned into
+// response.FieldErrors by HTTPErrorHandler.
+type Validator struct {
+	validate *validator.Validate
+}
+
+func NewValidator() *Validator {
+	return &Validator{validate: models.NewValidator()}
+}
+
+func (v *Validator) Validate(i interface{}) error {
+	return v.validate.Struct(i)
+}
+
+func toFieldErrors(errs validator.ValidationErrors) []response.FieldError {
+	fields := make([]response.FieldError, 0, len(errs))
+	for _, fe := range errs {
+		field := fe.Field()
+		// Drop the struct name that starts the namespace
+		if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+			field = path
+		}
+		fields = append(fields, response.FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fieldMessage(field, fe),
+		})
+	}
+	return fields
+}
+
+func fieldMessage(field string, fe validator.FieldError) string {
+	// Lengths apply to strings and collections; everything else compares values
+	sized := false
+	switch fe.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		sized = true
+	}
+
+	switch fe.Tag() {
+	case "required", "required_if", "required_unless", "required_with", "required_without":
+		return fmt.Sprintf("%s is required", field)
+	case "min", "gte":
+		if sized {
+			return fmt.Sprintf("%s must have at least %s %s", field, fe.Param(), unit(fe))
+		}
+		return fmt.Sprintf("%s must be at least %s", field, fe.Param())
+	case "max", "lte":
+		if sized {
+			return fmt.Sprintf("%s must have at most %s %s", field, fe.Param(), unit(fe))
+		}
+		return fmt.Sprintf("%s must be at most %s", field, fe.Param())
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", field, fe.Param())
+	case "lt":
+		return fmt.Sprintf("%s must be less than %s", field, fe.Param())
+	case "len":
+		return fmt.Sprintf("%s must have exactly %s %s", field, fe.Param(), unit(fe))
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(fe.Param(), " ", ", "))
+	}
+	return fmt.Sprintf("%s failed the %s rule", field, fe.Tag())
+}
+
+func unit(fe validator.FieldError) string {
+	if fe.Kind() == reflect.String {
+		return "characters"
+	}
+	return "items"
+}
@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"fmt"
+	"p3-graded-challenge-1-ziancarlos/auth"
+	"p3-graded-challenge-1-ziancarlos/controllers"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// JWT rejects requests without a valid "Authorization: Bearer" token and
+// stores the caller's claims in the request context for the services.
+func JWT(verifier *auth.Verifier) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			scheme, token, found := strings.Cut(header, " ")
+			if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer`)
+				return controllers.WithMessage("Authentication required", auth.ErrMissingToken)
+			}
+
+			claims, err := verifier.Verify(strings.TrimSpace(token))
+			if err != nil {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+				return controllers.WithMessage("Authentication required", err)
+			}
+
+			c.SetRequest(c.Request().WithContext(auth.WithClaims(c.Request().Context(), claims)))
+			return next(c)
+		}
+	}
+}
+
+// Require lets the request through only when the caller's role holds
+// permission under policy. It must run after JWT.
+func Require(policy *auth.Policy, permission auth.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !policy.Can(c.Request().Context(), permission) {
+				return controllers.WithMessage("Access denied", fmt.Errorf("%w: %s required", auth.ErrForbidden, permission))
+			}
+			return next(c)
+		}
+	}
+}
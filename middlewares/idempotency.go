@@ -0,0 +1,101 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"p3-graded-challenge-1-ziancarlos/apperrors"
+	"p3-graded-challenge-1-ziancarlos/auth"
+	"p3-graded-challenge-1-ziancarlos/controllers"
+	"p3-graded-challenge-1-ziancarlos/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+var errIdempotencyKeyTooLong = apperrors.InvalidArgument("invalid_idempotency_key", "idempotency key must be at most 255 characters")
+
+// Idempotency replays the stored response when a request is retried with the
+// same Idempotency-Key header. Requests without the header pass through.
+func Idempotency(svc service.IdempotencyService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderIdempotencyKey)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return controllers.WithMessage("Invalid Idempotency-Key header", errIdempotencyKeyTooLong)
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return controllers.WithMessage("Invalid request body", apperrors.Wrap(apperrors.KindInvalidArgument, "invalid_body", err))
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			// Keys are scoped per endpoint so clients may reuse them across
+			// resources, and per caller so one user cannot replay another's response
+			scopedKey := c.Request().URL.Path + ":" + key
+			if subject := auth.Subject(c.Request().Context()); subject != "" {
+				scopedKey = subject + ":" + scopedKey
+			}
+
+			ctx := c.Request().Context()
+			record, err := svc.Begin(ctx, scopedKey, c.Request().Method, c.Request().URL.Path, body)
+			if err != nil {
+				if errors.Is(err, service.ErrIdempotencyKeyReused) || errors.Is(err, service.ErrIdempotencyKeyInProcess) {
+					return controllers.WithMessage("Idempotency key conflict", err)
+				}
+				return controllers.WithMessage("Failed to process idempotency key", err)
+			}
+			if record != nil {
+				c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+				return c.Blob(record.StatusCode, record.ContentType, record.Body)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+
+			if err := next(c); err != nil {
+				// Write the error response now so that it is recorded like any other
+				c.Error(err)
+			}
+
+			// The handler has finished; record its outcome even if the client left
+			ctx = context.WithoutCancel(ctx)
+			status := c.Response().Status
+			if status >= http.StatusInternalServerError {
+				// Server-side failures are not final; let the client retry with the same key
+				if releaseErr := svc.Release(ctx, scopedKey); releaseErr != nil {
+					log.Printf("failed to release idempotency key %q: %v", scopedKey, releaseErr)
+				}
+				return nil
+			}
+
+			contentType := c.Response().Header().Get(echo.HeaderContentType)
+			if completeErr := svc.Complete(ctx, scopedKey, status, contentType, recorder.body.Bytes()); completeErr != nil {
+				log.Printf("failed to store idempotent response for %q: %v", scopedKey, completeErr)
+			}
+			return nil
+		}
+	}
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
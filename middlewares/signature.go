@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"p3-graded-challenge-1-ziancarlos/apperrors"
+	"p3-graded-challenge-1-ziancarlos/controllers"
+	"p3-graded-challenge-1-ziancarlos/signing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequireSignature rejects requests that are unsigned, signed with another
+// secret, outside the timestamp window or replayed. It reads the whole body,
+// so it must run behind a body size limit.
+func RequireSignature(verifier *signing.Verifier) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) {
+					// Body limit exceeded
+					return controllers.WithMessage("Request body too large", err)
+				}
+				return controllers.WithMessage("Invalid request body", apperrors.Wrap(apperrors.KindInvalidArgument, "invalid_body", err))
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			if err := verifier.Verify(c.Request().Context(), c.Request(), body); err != nil {
+				return controllers.WithMessage("Request signature rejected", err)
+			}
+			return next(c)
+		}
+	}
+}
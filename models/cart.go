@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CartStatusActive     = "active"
+	CartStatusCheckedOut = "checked_out"
+)
+
+// Cart is a server-side basket. It only stores products and quantities;
+// prices are always read live from the catalog and fixed at checkout.
+type Cart struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Items  []CartItem         `json:"items" bson:"items"`
+	Status string             `json:"status" bson:"status"`
+	// OrderID is the order the cart was checked out into
+	OrderID *primitive.ObjectID `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	// CreatedBy is the subject of the token the cart was created with
+	CreatedBy string    `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+	// ExpiresAt moves forward on every change; Mongo removes the cart after it
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+type CartItem struct {
+	ProductID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Quantity  int64              `json:"quantity" bson:"quantity"`
+}
+
+type CartRequest struct {
+	Items []CartItemRequest `json:"items,omitempty" validate:"omitempty,max=50,dive"`
+}
+
+type CartItemRequest struct {
+	ProductID string `json:"product_id" validate:"required"`
+	// Quantity is added to what is already in the cart
+	Quantity int64 `json:"quantity" validate:"required,min=1,max=10000"`
+}
+
+type CartItemUpdateRequest struct {
+	Quantity int64 `json:"quantity" validate:"required,min=1,max=10000"`
+}
+
+type CheckoutRequest struct {
+	PaymentMethod string `json:"payment_method" validate:"required"`
+}
+
+type CartResponse struct {
+	ID     string             `json:"id"`
+	Items  []CartItemResponse `json:"items"`
+	Status string             `json:"status"`
+	// Total is omitted when the cart mixes currencies or is too large to add up
+	Total     *Money    `json:"total,omitempty"`
+	OrderID   string    `json:"order_id,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CartItemResponse carries the current catalog price of a line. Lines whose
+// product has been removed are Unavailable and left out of the total.
+type CartItemResponse struct {
+	ProductID   string `json:"product_id"`
+	Name        string `json:"name,omitempty"`
+	Quantity    int64  `json:"quantity"`
+	UnitPrice   *Money `json:"unit_price,omitempty"`
+	LineTotal   *Money `json:"line_total,omitempty"`
+	Available   int64  `json:"available"`
+	Unavailable bool   `json:"unavailable,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// IdempotencyRecord stores the first response produced for an Idempotency-Key
+// so that retries of the same request can be answered without re-executing it.
+type IdempotencyRecord struct {
+	Key         string `bson:"_id"`
+	RequestHash string `bson:"request_hash"`
+	Completed   bool   `bson:"completed"`
+	// LockedUntil is when the request holding an uncompleted key is presumed
+	// dead, so that a retry may take the key over
+	LockedUntil time.Time `bson:"locked_until,omitempty"`
+	StatusCode  int       `bson:"status_code,omitempty"`
+	ContentType string    `bson:"content_type,omitempty"`
+	Body        []byte    `bson:"body,omitempty"`
+	CreatedAt   time.Time `bson:"created_at"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
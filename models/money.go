@@ -0,0 +1,256 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"p3-graded-challenge-1-ziancarlos/apperrors"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// DefaultCurrency is used for amounts given without a currency.
+const DefaultCurrency = "IDR"
+
+// currencyExponents lists the supported ISO 4217 currencies and how many
+// decimal places their minor unit has.
+var currencyExponents = map[string]int{
+	"AUD": 2,
+	"BHD": 3,
+	"CNY": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"IDR": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"MYR": 2,
+	"SGD": 2,
+	"USD": 2,
+}
+
+var (
+	ErrUnsupportedCurrency = apperrors.InvalidArgument("unsupported_currency", "unsupported currency")
+	ErrCurrencyMismatch    = apperrors.InvalidArgument("currency_mismatch", "currency mismatch")
+	ErrInvalidAmount       = apperrors.InvalidArgument("invalid_amount", "invalid amount")
+)
+
+// Money is an exact amount in the minor unit of its currency (e.g. cents).
+//
+// In JSON it is written as {"amount": 12.50, "currency": "USD"}. For
+// backward compatibility a bare number is also accepted and is read in
+// DefaultCurrency. In BSON it is stored as {amount: <int64 minor units>, currency}.
+type Money struct {
+	// Amount is in minor units; JSON shows it in major units
+	Amount   int64  `json:"amount" swaggertype:"number" example:"12.5"`
+	Currency string `json:"currency" example:"IDR"`
+}
+
+// NewMoney returns minor units of currency as Money.
+func NewMoney(minor int64, currency string) Money {
+	return Money{Amount: minor, Currency: currency}
+}
+
+// ParseMoney reads a decimal string such as "12.50" in currency, rejecting
+// values with more decimal places than the currency has.
+func ParseMoney(value string, currency string) (Money, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	exponent, ok := currencyExponents[currency]
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrUnsupportedCurrency, currency)
+	}
+
+	amount, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+	minor := amount.Mul(amount, new(big.Rat).SetInt(scale))
+	if !minor.IsInt() {
+		return Money{}, fmt.Errorf("%w: %s allows at most %d decimal places", ErrInvalidAmount, currency, exponent)
+	}
+	if !minor.Num().IsInt64() {
+		return Money{}, fmt.Errorf("%w: %q is out of range", ErrInvalidAmount, value)
+	}
+
+	return Money{Amount: minor.Num().Int64(), Currency: currency}, nil
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// Add, Sub and Mul fail with ErrInvalidAmount rather than wrap around when
+// the result does not fit in an int64.
+
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	sum := m.Amount + other.Amount
+	if (other.Amount > 0 && sum < m.Amount) || (other.Amount < 0 && sum > m.Amount) {
+		return Money{}, m.outOfRange()
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	difference := m.Amount - other.Amount
+	if (other.Amount < 0 && difference < m.Amount) || (other.Amount > 0 && difference > m.Amount) {
+		return Money{}, m.outOfRange()
+	}
+	return Money{Amount: difference, Currency: m.Currency}, nil
+}
+
+// Mul multiplies the amount by a whole quantity.
+func (m Money) Mul(quantity int64) (Money, error) {
+	product := m.Amount * quantity
+	if quantity != 0 && (product/quantity != m.Amount || (quantity == -1 && m.Amount == math.MinInt64)) {
+		return Money{}, m.outOfRange()
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+func (m Money) outOfRange() error {
+	return fmt.Errorf("%w: %s total is out of range", ErrInvalidAmount, m.Currency)
+}
+
+// Cmp returns -1, 0 or 1 like strings.Compare. Comparing different
+// currencies is an error.
+func (m Money) Cmp(other Money) (int, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m Money) sameCurrency(other Money) error {
+	if m.Currency != other.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return nil
+}
+
+// Decimal formats the amount in major units with exactly the currency's
+// number of decimal places, e.g. "12.50".
+func (m Money) Decimal() string {
+	exponent := currencyExponents[m.Currency]
+	if exponent == 0 {
+		return fmt.Sprintf("%d", m.Amount)
+	}
+
+	sign := ""
+	minor := m.Amount
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	scale := int64(math.Pow10(exponent))
+	return fmt.Sprintf("%s%d.%0*d", sign, minor/scale, exponent, minor%scale)
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+type moneyJSON struct {
+	Amount   json.Number `json:"amount"`
+	Currency string      `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{
+		Amount:   json.Number(m.Decimal()),
+		Currency: m.Currency,
+	})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var raw moneyJSON
+	switch {
+	case len(data) > 0 && data[0] == '{':
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&raw); err != nil {
+			return err
+		}
+		if raw.Currency == "" {
+			raw.Currency = DefaultCurrency
+		}
+	case len(data) > 0 && data[0] == '"':
+		var value string
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		raw = moneyJSON{Amount: json.Number(value), Currency: DefaultCurrency}
+	default:
+		// Legacy clients send a bare number
+		raw = moneyJSON{Amount: json.Number(data), Currency: DefaultCurrency}
+	}
+
+	parsed, err := ParseMoney(raw.Amount.String(), raw.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+type moneyBSON struct {
+	Amount   int64  `bson:"amount"`
+	Currency string `bson:"currency"`
+}
+
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	data, err := bson.Marshal(moneyBSON{Amount: m.Amount, Currency: m.Currency})
+	return bson.TypeEmbeddedDocument, data, err
+}
+
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bson.TypeEmbeddedDocument:
+		var raw moneyBSON
+		if err := bson.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		*m = Money{Amount: raw.Amount, Currency: raw.Currency}
+		return nil
+	case bson.TypeDouble:
+		// Documents written before Money existed hold a float in DefaultCurrency
+		value, _, ok := bsoncore.ReadDouble(data)
+		if !ok {
+			return fmt.Errorf("%w: malformed legacy amount", ErrInvalidAmount)
+		}
+		scale := math.Pow10(currencyExponents[DefaultCurrency])
+		*m = Money{Amount: int64(math.Round(value * scale)), Currency: DefaultCurrency}
+		return nil
+	case bson.TypeNull, bson.TypeUndefined:
+		*m = Money{}
+		return nil
+	}
+	return fmt.Errorf("%w: cannot decode BSON %s into Money", ErrInvalidAmount, t)
+}
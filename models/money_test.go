@@ -0,0 +1,133 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMoneyAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    Money
+		want    Money
+		wantErr error
+	}{
+		{"sum", NewMoney(1250, "USD"), NewMoney(50, "USD"), NewMoney(1300, "USD"), nil},
+		{"negative", NewMoney(100, "USD"), NewMoney(-250, "USD"), NewMoney(-150, "USD"), nil},
+		{"currency mismatch", NewMoney(100, "USD"), NewMoney(100, "EUR"), Money{}, ErrCurrencyMismatch},
+		{"overflow", NewMoney(math.MaxInt64, "USD"), NewMoney(1, "USD"), Money{}, ErrInvalidAmount},
+		{"underflow", NewMoney(math.MinInt64, "USD"), NewMoney(-1, "USD"), Money{}, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.Add(tt.b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Add() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Add() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneySub(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    Money
+		want    Money
+		wantErr error
+	}{
+		{"difference", NewMoney(1300, "USD"), NewMoney(50, "USD"), NewMoney(1250, "USD"), nil},
+		{"below zero", NewMoney(100, "USD"), NewMoney(250, "USD"), NewMoney(-150, "USD"), nil},
+		{"currency mismatch", NewMoney(100, "USD"), NewMoney(100, "EUR"), Money{}, ErrCurrencyMismatch},
+		{"overflow", NewMoney(math.MaxInt64, "USD"), NewMoney(-1, "USD"), Money{}, ErrInvalidAmount},
+		{"underflow", NewMoney(math.MinInt64, "USD"), NewMoney(1, "USD"), Money{}, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.Sub(tt.b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Sub() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Sub() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyMul(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        Money
+		quantity int64
+		want     Money
+		wantErr  error
+	}{
+		{"product", NewMoney(1250, "USD"), 3, NewMoney(3750, "USD"), nil},
+		{"zero quantity", NewMoney(1250, "USD"), 0, NewMoney(0, "USD"), nil},
+		{"largest that fits", NewMoney(math.MaxInt64/MaxItemQuantity, "USD"), MaxItemQuantity, NewMoney(math.MaxInt64/MaxItemQuantity*MaxItemQuantity, "USD"), nil},
+		{"overflow", NewMoney(math.MaxInt64/2+1, "USD"), 2, Money{}, ErrInvalidAmount},
+		{"negative overflow", NewMoney(math.MinInt64, "USD"), -1, Money{}, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.Mul(tt.quantity)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Mul() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Mul() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     Money
+		wantErr  error
+	}{
+		{"12.50", "usd", NewMoney(1250, "USD"), nil},
+		{"12", "JPY", NewMoney(12, "JPY"), nil},
+		{"1.234", "KWD", NewMoney(1234, "KWD"), nil},
+		{"12.505", "USD", Money{}, ErrInvalidAmount},
+		{"12.5", "JPY", Money{}, ErrInvalidAmount},
+		{"abc", "USD", Money{}, ErrInvalidAmount},
+		{"99999999999999999999", "USD", Money{}, ErrInvalidAmount},
+		{"1", "XXX", Money{}, ErrUnsupportedCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value+" "+tt.currency, func(t *testing.T) {
+			got, err := ParseMoney(tt.value, tt.currency)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseMoney() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{NewMoney(1250, "USD"), "12.50"},
+		{NewMoney(5, "USD"), "0.05"},
+		{NewMoney(-1250, "USD"), "-12.50"},
+		{NewMoney(1234, "KWD"), "1.234"},
+		{NewMoney(1200, "JPY"), "1200"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Decimal(); got != tt.want {
+			t.Errorf("%#v.Decimal() = %q, want %q", tt.m, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	OrderStatusPending = "pending"
+	OrderStatusPaid    = "paid"
+	OrderStatusFailed  = "failed"
+)
+
+// MaxOrderItems bounds the number of lines in one order.
+const MaxOrderItems = 50
+
+// MaxItemQuantity bounds the units a single request may buy, reserve or put
+// in a cart line, keeping totals far from overflowing.
+const MaxItemQuantity = 10000
+
+// Order is a basket of line items paid for with a single payment.
+type Order struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Items         []OrderItem        `json:"items" bson:"items"`
+	Total         Money              `json:"total" bson:"total"`
+	PaymentMethod string             `json:"payment_method" bson:"payment_method"`
+	PaymentID     string             `json:"payment_id" bson:"payment_id"`
+	Status        string             `json:"status" bson:"status"`
+	FailureReason string             `json:"failure_reason,omitempty" bson:"failure_reason,omitempty"`
+	// CreatedBy is the subject of the token the order was created with
+	CreatedBy string    `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type OrderItem struct {
+	ProductID     primitive.ObjectID  `json:"product_id" bson:"product_id"`
+	Name          string              `json:"name" bson:"name"`
+	Quantity      int64               `json:"quantity" bson:"quantity"`
+	UnitPrice     Money               `json:"unit_price" bson:"unit_price"`
+	LineTotal     Money               `json:"line_total" bson:"line_total"`
+	ReservationID *primitive.ObjectID `json:"reservation_id,omitempty" bson:"reservation_id,omitempty"`
+}
+
+type OrderRequest struct {
+	Items         []OrderItemRequest `json:"items" validate:"required,min=1,max=50,dive"`
+	PaymentMethod string             `json:"payment_method" validate:"required"`
+}
+
+type OrderItemRequest struct {
+	ProductID string `json:"product_id" validate:"required"`
+	// Quantity defaults to 1
+	Quantity int64 `json:"quantity" validate:"omitempty,min=1,max=10000"`
+	// Price is the expected unit price; when set it must equal the current catalog price.
+	Price Money `json:"price" validate:"omitempty,gt=0"`
+}
+
+type OrderResponse struct {
+	ID            string              `json:"id"`
+	Items         []OrderItemResponse `json:"items"`
+	Total         Money               `json:"total"`
+	PaymentMethod string              `json:"payment_method"`
+	PaymentID     string              `json:"payment_id"`
+	Status        string              `json:"status"`
+	FailureReason string              `json:"failure_reason,omitempty"`
+	CreatedBy     string              `json:"created_by,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+}
+
+type OrderItemResponse struct {
+	ProductID string `json:"product_id"`
+	Name      string `json:"name"`
+	Quantity  int64  `json:"quantity"`
+	UnitPrice Money  `json:"unit_price"`
+	LineTotal Money  `json:"line_total"`
+}
+
+type OrderQuery struct {
+	Status string `query:"status" validate:"omitempty,oneof=pending paid failed"`
+	From   string `query:"from"`
+	To     string `query:"to"`
+	Cursor string `query:"cursor"`
+	Limit  int64  `query:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+// OrderFilter is the parsed form of OrderQuery used by the repository.
+// Results are ordered by (created_at, _id) descending; CursorDate/CursorID
+// mark the last record of the previous page.
+type OrderFilter struct {
+	Status     string
+	From       time.Time
+	To         time.Time
+	CursorDate time.Time
+	CursorID   primitive.ObjectID
+	Limit      int64
+	// CreatedBy limits the results to the orders of one subject
+	CreatedBy string
+}
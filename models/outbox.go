@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	OutboxTypePaymentCharge = "payment.charge"
+	OutboxTypePaymentVoid   = "payment.void"
+	OutboxTypePaymentRefund = "payment.refund"
+)
+
+const (
+	OutboxStatusPending    = "pending"
+	OutboxStatusProcessing = "processing"
+	OutboxStatusDone       = "done"
+	OutboxStatusFailed     = "failed"
+)
+
+// OutboxEntry is a saga step that the payment worker still has to perform
+// against the payment service. It belongs to either a transaction or, when
+// OrderID is set, an order.
+type OutboxEntry struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	Type          string             `bson:"type"`
+	TransactionID primitive.ObjectID `bson:"transaction_id,omitempty"`
+	OrderID       primitive.ObjectID `bson:"order_id,omitempty"`
+	PaymentID     string             `bson:"payment_id,omitempty"`
+	Amount        Money              `bson:"amount"`
+	Status        string             `bson:"status"`
+	Attempts      int                `bson:"attempts"`
+	LastError     string             `bson:"last_error,omitempty"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at"`
+	LockedUntil   time.Time          `bson:"locked_until,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+const (
+	DefaultPageLimit int64 = 20
+	MaxPageLimit     int64 = 100
+)
+
+// PageMeta describes the page returned by a list endpoint.
+type PageMeta struct {
+	Page       int64  `json:"page,omitempty"`
+	Limit      int64  `json:"limit"`
+	Total      *int64 `json:"total,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
@@ -1,20 +1,73 @@
 package models
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Payment lifecycle: authorized -> captured | voided,
+// captured -> partially_refunded | refunded, partially_refunded -> refunded.
+const (
+	PaymentStatusAuthorized        = "authorized"
+	PaymentStatusCaptured          = "captured"
+	PaymentStatusVoided            = "voided"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+	PaymentStatusRefunded          = "refunded"
+)
+
 type Payment struct {
-	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Amount float64            `json:"amount" bson:"amount" validate:"required,gt=0"`
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Amount         Money              `json:"amount" bson:"amount" validate:"required,gt=0"`
+	Status         string             `json:"status" bson:"status"`
+	RefundedAmount Money              `json:"refunded_amount" bson:"refunded_amount"`
+	TransactionID  string             `json:"transaction_id,omitempty" bson:"transaction_id,omitempty"`
+	OrderID        string             `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
 type PaymentRequest struct {
-	Amount float64 `json:"amount" validate:"required,gt=0"`
+	Amount Money `json:"amount" validate:"required,gt=0"`
+	// TransactionID references the shopping service transaction being paid for
+	TransactionID string `json:"transaction_id,omitempty"`
+	// OrderID references the shopping service order being paid for
+	OrderID string `json:"order_id,omitempty"`
 }
 
 type PaymentResponse struct {
-	ID     string  `json:"id"`
-	Amount float64 `json:"amount"`
+	ID             string    `json:"id"`
+	Amount         Money     `json:"amount"`
+	Status         string    `json:"status"`
+	RefundedAmount Money     `json:"refunded_amount"`
+	TransactionID  string    `json:"transaction_id,omitempty"`
+	OrderID        string    `json:"order_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
 }
 
+type PaymentQuery struct {
+	Page          int64  `query:"page" validate:"omitempty,min=1"`
+	Limit         int64  `query:"limit" validate:"omitempty,min=1,max=100"`
+	From          string `query:"from"`
+	To            string `query:"to"`
+	MinAmount     string `query:"min_amount"`
+	MaxAmount     string `query:"max_amount"`
+	Currency      string `query:"currency"`
+	Status        string `query:"status"`
+	TransactionID string `query:"transaction_id"`
+	OrderID       string `query:"order_id"`
+}
+
+// PaymentFilter is the parsed form of PaymentQuery used by the repository.
+type PaymentFilter struct {
+	From          time.Time
+	To            time.Time
+	MinAmount     Money
+	MaxAmount     Money
+	Status        string
+	TransactionID string
+	OrderID       string
+	Skip          int64
+	Limit         int64
+}
@@ -1,23 +1,77 @@
 package models
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Product struct {
 	ID    primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Name  string             `json:"name" bson:"name" validate:"required"`
-	Price float64            `json:"price" bson:"price" validate:"required,gt=0"`
+	Price Money              `json:"price" bson:"price" validate:"required,gt=0"`
+	// Stock is the number of units available to buy; reserved units are not included
+	Stock    int64 `json:"stock" bson:"stock" validate:"gte=0"`
+	Reserved int64 `json:"reserved" bson:"reserved"`
+	// DeletedAt is set when the product is soft deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	// Archived products were force deleted while transactions still pointed
+	// at them; they are kept for good so those transactions stay resolvable
+	Archived     bool   `json:"archived,omitempty" bson:"archived,omitempty"`
+	DeleteReason string `json:"delete_reason,omitempty" bson:"delete_reason,omitempty"`
 }
 
 type ProductRequest struct {
-	Name  string  `json:"name" validate:"required"`
-	Price float64 `json:"price" validate:"required,gt=0"`
+	Name  string `json:"name" validate:"required"`
+	Price Money  `json:"price" validate:"required,gt=0"`
+	// Stock is the initial quantity on create; afterwards use the stock adjustment endpoint
+	Stock int64 `json:"stock" validate:"gte=0"`
 }
 
 type ProductResponse struct {
-	ID    string  `json:"id"`
-	Name  string  `json:"name"`
-	Price float64 `json:"price"`
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Price Money  `json:"price"`
+	// Stock is every unit on hand: Available plus Reserved
+	Stock        int64      `json:"stock"`
+	Available    int64      `json:"available"`
+	Reserved     int64      `json:"reserved"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	Archived     bool       `json:"archived,omitempty"`
+	DeleteReason string     `json:"delete_reason,omitempty"`
+}
+
+// ProductDeleteQuery holds the options of a product delete. A product that
+// transactions, orders or open carts point at can only be deleted with force, which archives it and
+// needs a reason.
+type ProductDeleteQuery struct {
+	Force  bool   `query:"force"`
+	Reason string `query:"reason" validate:"required_if=Force true,max=500"`
 }
 
+type ProductQuery struct {
+	Page     int64  `query:"page" validate:"omitempty,min=1"`
+	Limit    int64  `query:"limit" validate:"omitempty,min=1,max=100"`
+	After    string `query:"after"`
+	Name     string `query:"name"`
+	MinPrice string `query:"min_price"`
+	MaxPrice string `query:"max_price"`
+	// Currency of min_price/max_price; only products priced in it match a price filter
+	Currency string `query:"currency"`
+	Sort     string `query:"sort" validate:"omitempty,oneof=price -price name"`
+	// IncludeDeleted also returns soft deleted products (admin)
+	IncludeDeleted bool `query:"include_deleted"`
+}
+
+// ProductFilter is the parsed form of ProductQuery used by the repository.
+type ProductFilter struct {
+	Name     string
+	MinPrice Money
+	MaxPrice Money
+	After    primitive.ObjectID
+	Sort     string
+	Skip     int64
+	Limit    int64
+
+	IncludeDeleted bool
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Refund is one (possibly partial) refund of a captured payment.
+type Refund struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	PaymentID primitive.ObjectID `json:"payment_id" bson:"payment_id"`
+	Amount    Money              `json:"amount" bson:"amount"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+type RefundRequest struct {
+	// Amount defaults to everything not yet refunded
+	Amount Money  `json:"amount,omitempty" validate:"omitempty,gt=0"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type RefundResponse struct {
+	ID        string    `json:"id"`
+	PaymentID string    `json:"payment_id"`
+	Amount    Money     `json:"amount"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// Payment is the payment after the refund was applied
+	Payment *PaymentResponse `json:"payment,omitempty"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reservation statuses. Reserved units are out of the product's available
+// stock until the reservation is converted into a sale or goes back to stock
+// as released or expired.
+const (
+	ReservationStatusActive    = "active"
+	ReservationStatusConverted = "converted"
+	ReservationStatusReleased  = "released"
+	ReservationStatusExpired   = "expired"
+)
+
+// Reservation holds units of a product for a buyer while they check out.
+type Reservation struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProductID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Quantity  int64              `json:"quantity" bson:"quantity"`
+	Status    string             `json:"status" bson:"status"`
+	// TransactionID or OrderID is set once the reservation has been claimed
+	TransactionID *primitive.ObjectID `json:"transaction_id,omitempty" bson:"transaction_id,omitempty"`
+	OrderID       *primitive.ObjectID `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	// CreatedBy is the subject of the token the reservation was made with
+	CreatedBy string    `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type ReservationRequest struct {
+	Quantity int64 `json:"quantity" validate:"required,min=1,max=10000"`
+	// TTLSeconds defaults to the configured reservation TTL and is capped at the maximum
+	TTLSeconds int64 `json:"ttl_seconds,omitempty" validate:"omitempty,min=1,max=86400"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reasons for a stock adjustment. Sale and sale_reversal are recorded by the
+// transaction flow and cannot be used through the adjustment endpoint.
+const (
+	StockReasonRestock      = "restock"
+	StockReasonDamaged      = "damaged"
+	StockReasonLost         = "lost"
+	StockReasonReturned     = "returned"
+	StockReasonCorrection   = "correction"
+	StockReasonSale         = "sale"
+	StockReasonSaleReversal = "sale_reversal"
+)
+
+// StockAdjustment is an audit record of one change to a product's stock.
+type StockAdjustment struct {
+	ID            primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ProductID     primitive.ObjectID  `json:"product_id" bson:"product_id"`
+	Quantity      int64               `json:"quantity" bson:"quantity"`
+	Reason        string              `json:"reason" bson:"reason"`
+	Note          string              `json:"note,omitempty" bson:"note,omitempty"`
+	TransactionID *primitive.ObjectID `json:"transaction_id,omitempty" bson:"transaction_id,omitempty"`
+	OrderID       *primitive.ObjectID `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	// StockAfter is the available stock once the change was applied
+	StockAfter int64     `json:"stock_after" bson:"stock_after"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+}
+
+type StockAdjustmentRequest struct {
+	// Quantity is added to the stock; use a negative value to remove units
+	Quantity int64  `json:"quantity" validate:"required"`
+	Reason   string `json:"reason" validate:"required,oneof=restock damaged lost returned correction"`
+	Note     string `json:"note,omitempty" validate:"max=500"`
+}
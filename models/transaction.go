@@ -6,35 +6,115 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	TransactionStatusPending = "pending"
+	TransactionStatusPaid    = "paid"
+	TransactionStatusFailed  = "failed"
+	// TransactionStatusCancelled is set when the buyer cancels before payment
+	TransactionStatusCancelled = "cancelled"
+	// TransactionStatusRefunded is set once the whole price has been refunded
+	TransactionStatusRefunded = "refunded"
+)
+
 type Transaction struct {
-	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	ProductID     primitive.ObjectID `json:"product_id" bson:"product_id" validate:"required"`
-	Date          time.Time          `json:"date" bson:"date"`
-	Price         float64            `json:"price" bson:"price" validate:"required,gt=0"`
-	PaymentMethod string             `json:"payment_method" bson:"payment_method" validate:"required"`
-	PaymentID     string             `json:"payment_id" bson:"payment_id"`
+	ID             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ProductID      primitive.ObjectID  `json:"product_id" bson:"product_id" validate:"required"`
+	Date           time.Time           `json:"date" bson:"date"`
+	Quantity       int64               `json:"quantity" bson:"quantity"`
+	ReservationID  *primitive.ObjectID `json:"reservation_id,omitempty" bson:"reservation_id,omitempty"`
+	UnitPrice      Money               `json:"unit_price" bson:"unit_price"`
+	Price          Money               `json:"price" bson:"price" validate:"required,gt=0"`
+	PaymentMethod  string              `json:"payment_method" bson:"payment_method" validate:"required"`
+	PaymentID      string              `json:"payment_id" bson:"payment_id"`
+	Status         string              `json:"status" bson:"status"`
+	FailureReason  string              `json:"failure_reason,omitempty" bson:"failure_reason,omitempty"`
+	RefundedAmount Money               `json:"refunded_amount" bson:"refunded_amount"`
+	StatusHistory  []StatusChange      `json:"status_history" bson:"status_history,omitempty"`
+	// CreatedBy is the subject of the token the transaction was created with
+	CreatedBy string `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	// DeletedAt is set when the transaction is soft deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+}
+
+// StatusChange records when a transaction entered a status and why.
+type StatusChange struct {
+	Status    string    `json:"status" bson:"status"`
+	Reason    string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	ChangedAt time.Time `json:"changed_at" bson:"changed_at"`
 }
 
 type TransactionRequest struct {
-	ProductID     string  `json:"product_id" validate:"required"`
-	Price         float64 `json:"price" validate:"required,gt=0"`
-	PaymentMethod string  `json:"payment_method" validate:"required"`
-	PaymentID     string  `json:"payment_id"`
+	ProductID string `json:"product_id" validate:"required"`
+	// Quantity defaults to 1, or to the reservation's quantity
+	Quantity int64 `json:"quantity" validate:"omitempty,min=1,max=10000"`
+	// ReservationID uses units reserved earlier instead of reserving new ones
+	ReservationID string `json:"reservation_id,omitempty"`
+	// Price is the expected unit price; when set it must equal the current catalog price.
+	Price         Money  `json:"price" validate:"omitempty,gt=0"`
+	PaymentMethod string `json:"payment_method" validate:"required"`
+	PaymentID     string `json:"payment_id"`
 }
 
+// TransactionUpdateRequest lists the fields a client may ask to change.
+// Which of them can actually change depends on the transaction's status;
+// the price is fixed once the transaction exists.
 type TransactionUpdateRequest struct {
-	ProductID     string  `json:"product_id" validate:"omitempty"`
-	Price         float64 `json:"price" validate:"omitempty,gt=0"`
-	PaymentMethod string  `json:"payment_method" validate:"omitempty"`
-	PaymentID     string  `json:"payment_id"`
+	Price         Money  `json:"price" validate:"omitempty,gt=0"`
+	PaymentMethod string `json:"payment_method" validate:"omitempty"`
+	PaymentID     string `json:"payment_id"`
 }
 
 type TransactionResponse struct {
-	ID            string    `json:"id"`
-	ProductID     string    `json:"product_id"`
-	Date          time.Time `json:"date"`
-	Price         float64   `json:"price"`
-	PaymentMethod string    `json:"payment_method"`
-	PaymentID     string    `json:"payment_id"`
+	ID             string         `json:"id"`
+	ProductID      string         `json:"product_id"`
+	Date           time.Time      `json:"date"`
+	Quantity       int64          `json:"quantity"`
+	ReservationID  string         `json:"reservation_id,omitempty"`
+	UnitPrice      Money          `json:"unit_price"`
+	Price          Money          `json:"price"`
+	PaymentMethod  string         `json:"payment_method"`
+	PaymentID      string         `json:"payment_id"`
+	Status         string         `json:"status"`
+	FailureReason  string         `json:"failure_reason,omitempty"`
+	RefundedAmount Money          `json:"refunded_amount"`
+	StatusHistory  []StatusChange `json:"status_history"`
+	CreatedBy      string         `json:"created_by,omitempty"`
+	DeletedAt      *time.Time     `json:"deleted_at,omitempty"`
+}
+
+type TransactionCancelRequest struct {
+	Reason string `json:"reason,omitempty" validate:"max=500"`
+}
+
+type TransactionQuery struct {
+	ProductID     string `query:"product_id"`
+	PaymentMethod string `query:"payment_method"`
+	From          string `query:"from"`
+	To            string `query:"to"`
+	MinPrice      string `query:"min_price"`
+	MaxPrice      string `query:"max_price"`
+	Currency      string `query:"currency"`
+	Cursor        string `query:"cursor"`
+	Limit         int64  `query:"limit" validate:"omitempty,min=1,max=100"`
+	// IncludeDeleted also returns soft deleted transactions (admin)
+	IncludeDeleted bool `query:"include_deleted"`
 }
 
+// TransactionFilter is the parsed form of TransactionQuery used by the repository.
+// Results are ordered by (date, _id) descending; CursorDate/CursorID mark the
+// last record of the previous page.
+type TransactionFilter struct {
+	ProductID     primitive.ObjectID
+	PaymentMethod string
+	From          time.Time
+	To            time.Time
+	MinPrice      Money
+	MaxPrice      Money
+	CursorDate    time.Time
+	CursorID      primitive.ObjectID
+	Limit         int64
+
+	// CreatedBy limits the results to the transactions of one subject
+	CreatedBy      string
+	IncludeDeleted bool
+}
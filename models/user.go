@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// User is an account that can log in to the shopping service.
+type User struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Username string             `json:"username" bson:"username"`
+	// PasswordHash is a bcrypt hash; the password itself is never stored
+	PasswordHash string `json:"-" bson:"password_hash"`
+	// Role decides what the user may do; see auth.Policy
+	Role      string    `json:"role" bson:"role"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type UserRequest struct {
+	Username string `json:"username" validate:"required,max=100"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+	Role     string `json:"role" validate:"required"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username" validate:"required,max=100"`
+	// Password is limited to 72 bytes, the most bcrypt uses
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+type LoginResponse struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// NewValidator returns a validator that understands the model types, e.g.
+// validating Money fields by their minor-unit amount so that gt=0 works.
+// Fields are reported by their JSON or query parameter name.
+func NewValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+		if money, ok := field.Interface().(Money); ok {
+			return money.Amount
+		}
+		return nil
+	}, Money{})
+	v.RegisterTagNameFunc(fieldName)
+	return v
+}
+
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "query"} {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
@@ -0,0 +1,298 @@
+// Package paymentclient is the shopping service's HTTP client for the payment service.
+package paymentclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/response"
+	"p3-graded-challenge-1-ziancarlos/signing"
+	"p3-graded-challenge-1-ziancarlos/tlsutil"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the payment service while it is
+// considered down.
+var ErrCircuitOpen = errors.New("payment service circuit breaker is open")
+
+// StatusError is returned when the payment service answers with an unexpected status.
+type StatusError struct {
+	StatusCode int
+	// Code is the error code of the response envelope, when it has one
+	Code string
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("payment service returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the same request may succeed if sent again. Of
+// the 409s only an idempotency key whose first request is still in flight
+// qualifies; the others, such as a payment that already moved on, are final.
+func (e *StatusError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusConflict:
+		return e.Code == codeIdempotencyKeyInProcess
+	}
+	return e.StatusCode >= 500
+}
+
+// codeIdempotencyKeyInProcess is the payment service's error code for a
+// request whose idempotency key is held by another request.
+const codeIdempotencyKeyInProcess = "idempotency_key_in_process"
+
+type Client interface {
+	CreatePayment(ctx context.Context, req *models.PaymentRequest, idempotencyKey string) (*models.PaymentResponse, error)
+	GetPayment(ctx context.Context, id string) (*models.PaymentResponse, error)
+	CapturePayment(ctx context.Context, id string, idempotencyKey string) (*models.PaymentResponse, error)
+	VoidPayment(ctx context.Context, id string, idempotencyKey string) (*models.PaymentResponse, error)
+	RefundPayment(ctx context.Context, id string, req *models.RefundRequest, idempotencyKey string) (*models.RefundResponse, error)
+}
+
+// TokenSource supplies the bearer token sent with every request.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+type client struct {
+	cfg        config.PaymentServiceConfig
+	httpClient *http.Client
+	breaker    *circuitBreaker
+	tokens     TokenSource
+}
+
+// NewClient returns a client that authenticates with tokens from tokens and,
+// when configured, with a client certificate.
+func NewClient(cfg config.PaymentServiceConfig, tokens TokenSource) (Client, error) {
+	tlsConfig, err := tlsutil.ClientConfig(cfg.CAFile, cfg.ClientCertFile, cfg.ClientKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConns
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &client{
+		cfg: cfg,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+		},
+		breaker: newCircuitBreaker(cfg.BreakerFailureThreshold, cfg.BreakerCooldown),
+		tokens:  tokens,
+	}, nil
+}
+
+func (c *client) CreatePayment(ctx context.Context, req *models.PaymentRequest, idempotencyKey string) (*models.PaymentResponse, error) {
+	var resp models.PaymentResponse
+	if err := c.do(ctx, http.MethodPost, "/payments", req, idempotencyKey, http.StatusCreated, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *client) GetPayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	var resp models.PaymentResponse
+	if err := c.do(ctx, http.MethodGet, "/payments/"+url.PathEscape(id), nil, "", http.StatusOK, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *client) CapturePayment(ctx context.Context, id string, idempotencyKey string) (*models.PaymentResponse, error) {
+	var resp models.PaymentResponse
+	if err := c.do(ctx, http.MethodPost, "/payments/"+url.PathEscape(id)+"/capture", nil, idempotencyKey, http.StatusOK, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *client) VoidPayment(ctx context.Context, id string, idempotencyKey string) (*models.PaymentResponse, error) {
+	var resp models.PaymentResponse
+	if err := c.do(ctx, http.MethodPost, "/payments/"+url.PathEscape(id)+"/void", nil, idempotencyKey, http.StatusOK, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *client) RefundPayment(ctx context.Context, id string, req *models.RefundRequest, idempotencyKey string) (*models.RefundResponse, error) {
+	var resp models.RefundResponse
+	if err := c.do(ctx, http.MethodPost, "/payments/"+url.PathEscape(id)+"/refunds", req, idempotencyKey, http.StatusCreated, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// do sends the request, retrying with exponential backoff on network errors,
+// timeouts and retryable statuses. Every attempt reuses idempotencyKey so the
+// payment service never applies the request twice.
+func (c *client) do(ctx context.Context, method, path string, body interface{}, idempotencyKey string, expectedStatus int, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to marshal payment request: %w", err)
+		}
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, c.backoff(attempt)); err != nil {
+				return lastErr
+			}
+		}
+
+		if !c.breaker.allow() {
+			return ErrCircuitOpen
+		}
+
+		lastErr = c.attempt(ctx, method, path, payload, idempotencyKey, expectedStatus, out)
+		c.record(ctx, lastErr)
+		if lastErr == nil {
+			return nil
+		}
+		if !retryable(lastErr) {
+			return lastErr
+		}
+	}
+
+	return lastErr
+}
+
+// record tells the breaker how the payment service did. Only an answer from
+// the service counts as a success, a 4xx included: the service is up and
+// turned the request down. Errors that never got an answer out of it, such
+// as a cancelled caller or a request that could not be signed, say nothing
+// about its health.
+func (c *client) record(ctx context.Context, err error) {
+	var statusErr *StatusError
+	switch {
+	case err == nil:
+		c.breaker.success()
+	case errors.As(err, &statusErr):
+		if statusErr.StatusCode >= 500 {
+			c.breaker.failure()
+		} else {
+			c.breaker.success()
+		}
+	case ctx.Err() == nil && retryable(err):
+		// The service could not be reached or did not answer in time
+		c.breaker.failure()
+	default:
+		c.breaker.release()
+	}
+}
+
+func (c *client) attempt(ctx context.Context, method, path string, payload []byte, idempotencyKey string, expectedStatus int, out interface{}) error {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.BaseURI+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create payment request: %w", err)
+	}
+
+	token, err := c.tokens.Token()
+	if err != nil {
+		return fmt.Errorf("failed to get payment service token: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	// Each attempt is signed afresh: a retry is a new request to the payment
+	// service, whose nonce check would reject a resent one
+	if err := signing.Sign(req, payload, []byte(c.cfg.SigningSecret)); err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call payment service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read payment response: %w", err)
+	}
+
+	if resp.StatusCode != expectedStatus {
+		statusErr := &StatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+		var envelope response.Error
+		if json.Unmarshal(bodyBytes, &envelope) == nil {
+			statusErr.Code = envelope.Code
+		}
+		return statusErr
+	}
+
+	if out != nil {
+		// Decoding into an envelope whose Data holds out fills out in place
+		if err := json.Unmarshal(bodyBytes, &response.Success{Data: out}); err != nil {
+			return fmt.Errorf("failed to unmarshal payment response: %w", err)
+		}
+	}
+	return nil
+}
+
+// backoff doubles the base delay per attempt, capped at RetryMaxDelay, with
+// up to 50% jitter so that concurrent callers do not retry in lockstep.
+func (c *client) backoff(attempt int) time.Duration {
+	delay := c.cfg.RetryBaseDelay << (attempt - 1)
+	if delay <= 0 || delay > c.cfg.RetryMaxDelay {
+		delay = c.cfg.RetryMaxDelay
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// IsRetryable reports whether err is a transient failure talking to the
+// payment service, as opposed to a definite rejection of the request.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrCircuitOpen) || retryable(err)
+}
+
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Retryable()
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
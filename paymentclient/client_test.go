@@ -0,0 +1,94 @@
+package paymentclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStatusErrorRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  StatusError
+		want bool
+	}{
+		{"bad request", StatusError{StatusCode: http.StatusBadRequest}, false},
+		{"not found", StatusError{StatusCode: http.StatusNotFound}, false},
+		{"idempotency key in process", StatusError{StatusCode: http.StatusConflict, Code: codeIdempotencyKeyInProcess}, true},
+		{"other conflict", StatusError{StatusCode: http.StatusConflict, Code: "invalid_payment_status"}, false},
+		{"conflict without code", StatusError{StatusCode: http.StatusConflict}, false},
+		{"unprocessable", StatusError{StatusCode: http.StatusUnprocessableEntity}, false},
+		{"too many requests", StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"internal error", StatusError{StatusCode: http.StatusInternalServerError}, true},
+		{"bad gateway", StatusError{StatusCode: http.StatusBadGateway}, true},
+		{"unavailable", StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Retryable(); got != tt.want {
+				t.Errorf("Retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"circuit open", ErrCircuitOpen, true},
+		{"wrapped server error", fmt.Errorf("capture: %w", &StatusError{StatusCode: http.StatusBadGateway}), true},
+		{"wrapped client error", fmt.Errorf("capture: %w", &StatusError{StatusCode: http.StatusBadRequest}), false},
+		{"deadline", context.DeadlineExceeded, true},
+		{"truncated response", io.ErrUnexpectedEOF, true},
+		{"cancelled", context.Canceled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordOnlyCountsAnswers(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		// want is whether the breaker lets the next call through after a
+		// half-open probe ended with err
+		want bool
+	}{
+		{"success", context.Background(), nil, true},
+		{"client error", context.Background(), &StatusError{StatusCode: http.StatusConflict}, true},
+		{"server error", context.Background(), &StatusError{StatusCode: http.StatusBadGateway}, false},
+		{"timeout", context.Background(), context.DeadlineExceeded, false},
+		{"cancelled caller", cancelled, fmt.Errorf("failed to call payment service: %w", context.Canceled), true},
+		{"local failure", context.Background(), fmt.Errorf("failed to get payment service token: %w", io.EOF), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &client{breaker: newCircuitBreaker(1, time.Minute)}
+			c.breaker.failure()
+			c.breaker.openedAt = time.Now().Add(-time.Hour)
+			if !c.breaker.allow() {
+				t.Fatal("breaker did not let the probe through")
+			}
+
+			c.record(tt.ctx, tt.err)
+			if got := c.breaker.allow(); got != tt.want {
+				t.Errorf("allow() after probe = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
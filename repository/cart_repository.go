@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrCartFull is returned by AddItem when the cart already holds the maximum
+// number of lines.
+var ErrCartFull = errors.New("cart is full")
+
+// ErrCartItemNotFound is returned when the product is not in the cart.
+var ErrCartItemNotFound = errors.New("product is not in the cart")
+
+// ErrCartNotActive is returned when changing a cart that was checked out.
+var ErrCartNotActive = errors.New("cart is no longer active")
+
+// ErrCartItemQuantity is returned by AddItem when the line would hold more
+// than models.MaxItemQuantity units.
+var ErrCartItemQuantity = errors.New("cart line quantity limit reached")
+
+// CartRepository changes only active, unexpired carts; every change pushes
+// the expiry forward to expiresAt. Missing and expired carts are reported as
+// mongo.ErrNoDocuments.
+type CartRepository interface {
+	Create(ctx context.Context, cart *models.Cart) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Cart, error)
+	// AddItem adds quantity units of the product, merging with an existing line.
+	AddItem(ctx context.Context, id, productID primitive.ObjectID, quantity int64, expiresAt time.Time) (*models.Cart, error)
+	SetItemQuantity(ctx context.Context, id, productID primitive.ObjectID, quantity int64, expiresAt time.Time) (*models.Cart, error)
+	RemoveItem(ctx context.Context, id, productID primitive.ObjectID, expiresAt time.Time) (*models.Cart, error)
+	// UpdateStatus only succeeds while the cart is still in status from.
+	UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to string, fields bson.M) error
+	EnsureIndexes(ctx context.Context) error
+}
+
+type cartRepository struct {
+	collection *mongo.Collection
+	timeouts   config.TimeoutConfig
+}
+
+func NewCartRepository(db *mongo.Database, timeouts config.TimeoutConfig) CartRepository {
+	return &cartRepository{
+		collection: db.Collection("carts"),
+		timeouts:   timeouts,
+	}
+}
+
+func (r *cartRepository) Create(ctx context.Context, cart *models.Cart) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	now := time.Now()
+	cart.Status = models.CartStatusActive
+	cart.CreatedAt = now
+	cart.UpdatedAt = now
+	if cart.Items == nil {
+		cart.Items = []models.CartItem{}
+	}
+
+	result, err := r.collection.InsertOne(ctx, cart)
+	if err != nil {
+		return err
+	}
+
+	cart.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *cartRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	// The TTL monitor only runs about once a minute, so filter expired carts too
+	filter := bson.M{"_id": id, "expires_at": bson.M{"$gt": time.Now()}}
+
+	var cart models.Cart
+	if err := r.collection.FindOne(ctx, filter).Decode(&cart); err != nil {
+		return nil, err
+	}
+
+	return &cart, nil
+}
+
+func (r *cartRepository) AddItem(ctx context.Context, id, productID primitive.ObjectID, quantity int64, expiresAt time.Time) (*models.Cart, error) {
+	// Merge into the existing line first; only push a new line when there is none
+	line := bson.M{"product_id": productID, "quantity": bson.M{"$lte": models.MaxItemQuantity - quantity}}
+	cart, err := r.modify(ctx, bson.M{"items": bson.M{"$elemMatch": line}}, bson.M{
+		"$inc": bson.M{"items.$.quantity": quantity},
+	}, id, expiresAt)
+	if err != mongo.ErrNoDocuments {
+		return cart, err
+	}
+
+	lastLine := fmt.Sprintf("items.%d", models.MaxOrderItems-1)
+	cart, err = r.modify(ctx, bson.M{"items.product_id": bson.M{"$ne": productID}, lastLine: bson.M{"$exists": false}}, bson.M{
+		"$push": bson.M{"items": models.CartItem{ProductID: productID, Quantity: quantity}},
+	}, id, expiresAt)
+	if err == mongo.ErrNoDocuments {
+		return nil, r.explain(ctx, id, productID, ErrCartFull)
+	}
+	return cart, err
+}
+
+func hasProduct(cart *models.Cart, productID primitive.ObjectID) bool {
+	for _, item := range cart.Items {
+		if item.ProductID == productID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *cartRepository) SetItemQuantity(ctx context.Context, id, productID primitive.ObjectID, quantity int64, expiresAt time.Time) (*models.Cart, error) {
+	cart, err := r.modify(ctx, bson.M{"items.product_id": productID}, bson.M{
+		"$set": bson.M{"items.$.quantity": quantity},
+	}, id, expiresAt)
+	if err == mongo.ErrNoDocuments {
+		return nil, r.explain(ctx, id, productID, ErrCartItemNotFound)
+	}
+	return cart, err
+}
+
+func (r *cartRepository) RemoveItem(ctx context.Context, id, productID primitive.ObjectID, expiresAt time.Time) (*models.Cart, error) {
+	cart, err := r.modify(ctx, bson.M{"items.product_id": productID}, bson.M{
+		"$pull": bson.M{"items": bson.M{"product_id": productID}},
+	}, id, expiresAt)
+	if err == mongo.ErrNoDocuments {
+		return nil, r.explain(ctx, id, productID, ErrCartItemNotFound)
+	}
+	return cart, err
+}
+
+// modify applies update to the active, unexpired cart when it also matches
+// filter, and returns the cart after the change.
+func (r *cartRepository) modify(ctx context.Context, filter, update bson.M, id primitive.ObjectID, expiresAt time.Time) (*models.Cart, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	now := time.Now()
+	filter["_id"] = id
+	filter["status"] = models.CartStatusActive
+	filter["expires_at"] = bson.M{"$gt": now}
+	update["$set"] = mergeSet(update["$set"], bson.M{"updated_at": now, "expires_at": expiresAt})
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var cart models.Cart
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&cart); err != nil {
+		return nil, err
+	}
+
+	return &cart, nil
+}
+
+func mergeSet(existing interface{}, fields bson.M) bson.M {
+	set, _ := existing.(bson.M)
+	if set == nil {
+		set = bson.M{}
+	}
+	for k, v := range fields {
+		set[k] = v
+	}
+	return set
+}
+
+// explain tells a cart that cannot be changed apart from the item-level
+// reason a conditional update matched nothing.
+func (r *cartRepository) explain(ctx context.Context, id, productID primitive.ObjectID, itemErr error) error {
+	cart, err := r.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if cart.Status != models.CartStatusActive {
+		return ErrCartNotActive
+	}
+	if itemErr == ErrCartFull && hasProduct(cart, productID) {
+		// The line exists, so it was its quantity that did not fit
+		return ErrCartItemQuantity
+	}
+	return itemErr
+}
+
+func (r *cartRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to string, fields bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	set := bson.M{"status": to, "updated_at": time.Now()}
+	for k, v := range fields {
+		set[k] = v
+	}
+
+	filter := bson.M{"_id": id, "status": from, "expires_at": bson.M{"$gt": time.Now()}}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *cartRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Maintenance)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
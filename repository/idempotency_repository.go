@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type IdempotencyRepository interface {
+	// Reserve inserts record unless the key is already taken, in which case the
+	// stored record is returned instead. An uncompleted record for the same
+	// request whose lock has run out is replaced by record.
+	Reserve(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error
+	Release(ctx context.Context, key string) error
+	EnsureIndexes(ctx context.Context) error
+}
+
+type idempotencyRepository struct {
+	collection *mongo.Collection
+	timeouts   config.TimeoutConfig
+}
+
+func NewIdempotencyRepository(db *mongo.Database, timeouts config.TimeoutConfig) IdempotencyRepository {
+	return &idempotencyRepository{
+		collection: db.Collection("idempotency_keys"),
+		timeouts:   timeouts,
+	}
+}
+
+func (r *idempotencyRepository) Reserve(ctx context.Context, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, record)
+	if err == nil {
+		return nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	var existing models.IdempotencyRecord
+	if err := r.collection.FindOne(ctx, bson.M{"_id": record.Key}).Decode(&existing); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	// The TTL monitor only runs periodically, so expired keys can still be present
+	if existing.ExpiresAt.Before(now) {
+		if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": record.Key, "expires_at": existing.ExpiresAt}); err != nil {
+			return nil, err
+		}
+		if _, err := r.collection.InsertOne(ctx, record); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	// The request that claimed the key died without completing or releasing
+	// it; a retry of the same request takes over
+	if !existing.Completed && existing.RequestHash == record.RequestHash && existing.LockedUntil.Before(now) {
+		// Matching the old lock lets only one retry win the takeover. Records
+		// from before locks were kept have none and are always stale.
+		var lock interface{} = bson.M{"$exists": false}
+		if !existing.LockedUntil.IsZero() {
+			lock = existing.LockedUntil
+		}
+		result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": record.Key, "completed": false, "locked_until": lock}, record)
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount > 0 {
+			return nil, nil
+		}
+		// Another retry took it over first
+	}
+
+	return &existing, nil
+}
+
+func (r *idempotencyRepository) Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	updateDoc := bson.M{
+		"$set": bson.M{
+			"completed":    true,
+			"status_code":  statusCode,
+			"content_type": contentType,
+			"body":         body,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": key}, updateDoc)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *idempotencyRepository) Release(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": key, "completed": false})
+	return err
+}
+
+func (r *idempotencyRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Maintenance)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Documents written before Money existed hold amounts as a bare double in
+// models.DefaultCurrency. Money decodes them either way, but filters and sorts
+// on <field>.amount and <field>.currency do not see them, so
+// migrateLegacyMoney rewrites them once at startup.
+
+// migrateLegacyMoney rewrites each of fields that is still stored as a double
+// into the document Money writes, and reports how many fields it changed.
+func migrateLegacyMoney(ctx context.Context, collection *mongo.Collection, timeout time.Duration, fields ...string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var migrated int64
+	for _, field := range fields {
+		n, err := migrateLegacyMoneyField(ctx, collection, field)
+		migrated += n
+		if err != nil {
+			return migrated, err
+		}
+	}
+
+	return migrated, nil
+}
+
+func migrateLegacyMoneyField(ctx context.Context, collection *mongo.Collection, field string) (int64, error) {
+	opts := options.Find().SetProjection(bson.M{field: 1})
+	cursor, err := collection.Find(ctx, bson.M{field: bson.M{"$type": "double"}}, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var migrated int64
+	for cursor.Next(ctx) {
+		legacy := cursor.Current.Lookup(field)
+
+		// Convert exactly as reads do, so nothing changes for API clients
+		var amount models.Money
+		if err := amount.UnmarshalBSONValue(legacy.Type, legacy.Value); err != nil {
+			return migrated, err
+		}
+
+		// Matching the old value leaves a document written in the meantime alone
+		filter := bson.M{"_id": cursor.Current.Lookup("_id"), field: legacy}
+		result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{field: amount}})
+		if err != nil {
+			return migrated, err
+		}
+		migrated += result.ModifiedCount
+	}
+
+	return migrated, cursor.Err()
+}
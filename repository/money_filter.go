@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"p3-graded-challenge-1-ziancarlos/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// addMoneyRange restricts field (a Money sub-document) to [min, max]. Zero
+// bounds are ignored; a bound also restricts the currency, since amounts in
+// different currencies cannot be compared.
+func addMoneyRange(query bson.M, field string, min, max models.Money) {
+	amountRange := bson.M{}
+	if !min.IsZero() {
+		amountRange["$gte"] = min.Amount
+		query[field+".currency"] = min.Currency
+	}
+	if !max.IsZero() {
+		amountRange["$lte"] = max.Amount
+		query[field+".currency"] = max.Currency
+	}
+	if len(amountRange) > 0 {
+		query[field+".amount"] = amountRange
+	}
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NonceRepository remembers the nonces of signed requests until they expire.
+// It satisfies signing.NonceStore.
+type NonceRepository interface {
+	Claim(ctx context.Context, nonce string, expiresAt time.Time) (bool, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type nonceRepository struct {
+	collection *mongo.Collection
+	timeouts   config.TimeoutConfig
+}
+
+func NewNonceRepository(db *mongo.Database, timeouts config.TimeoutConfig) NonceRepository {
+	return &nonceRepository{
+		collection: db.Collection("request_nonces"),
+		timeouts:   timeouts,
+	}
+}
+
+func (r *nonceRepository) Claim(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := r.collection.InsertOne(ctx, bson.M{"_id": nonce, "expires_at": expiresAt})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *nonceRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Maintenance)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type OrderRepository interface {
+	Create(ctx context.Context, order *models.Order) error
+	FindAll(ctx context.Context, filter *models.OrderFilter) ([]models.Order, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Order, error)
+	// UpdateStatus only succeeds while the order is still in status from.
+	UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to string, fields bson.M) error
+	// ExistsByProductID reports whether any order has a line for the product.
+	ExistsByProductID(ctx context.Context, productID primitive.ObjectID) (bool, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type orderRepository struct {
+	collection *mongo.Collection
+	timeouts   config.TimeoutConfig
+}
+
+func NewOrderRepository(db *mongo.Database, timeouts config.TimeoutConfig) OrderRepository {
+	return &orderRepository{
+		collection: db.Collection("orders"),
+		timeouts:   timeouts,
+	}
+}
+
+func (r *orderRepository) Create(ctx context.Context, order *models.Order) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	now := time.Now()
+	order.Status = models.OrderStatusPending
+	order.CreatedAt = now
+	order.UpdatedAt = now
+
+	result, err := r.collection.InsertOne(ctx, order)
+	if err != nil {
+		return err
+	}
+
+	order.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *orderRepository) FindAll(ctx context.Context, filter *models.OrderFilter) ([]models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+
+	query := bson.M{}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.CreatedBy != "" {
+		query["created_by"] = filter.CreatedBy
+	}
+
+	dateRange := bson.M{}
+	if !filter.From.IsZero() {
+		dateRange["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		dateRange["$lt"] = filter.To
+	}
+	if len(dateRange) > 0 {
+		query["created_at"] = dateRange
+	}
+
+	// Keyset pagination: everything strictly after the cursor in (created_at, _id) desc order
+	if !filter.CursorID.IsZero() {
+		query["$or"] = bson.A{
+			bson.M{"created_at": bson.M{"$lt": filter.CursorDate}},
+			bson.M{"created_at": filter.CursorDate, "_id": bson.M{"$lt": filter.CursorID}},
+		}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(filter.Limit)
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var orders []models.Order
+	if err = cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (r *orderRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	var order models.Order
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&order)
+	if err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+func (r *orderRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to string, fields bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	set := bson.M{"status": to, "updated_at": time.Now()}
+	for k, v := range fields {
+		set[k] = v
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": from}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *orderRepository) ExistsByProductID(ctx context.Context, productID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	count, err := r.collection.CountDocuments(ctx, bson.M{"items.product_id": productID}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *orderRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Maintenance)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "created_by", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "items.product_id", Value: 1}}},
+	})
+	return err
+}
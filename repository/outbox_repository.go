@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type OutboxRepository interface {
+	Create(ctx context.Context, entry *models.OutboxEntry) error
+	// ClaimNext locks the oldest due entry for lockTimeout. Entries whose lock
+	// expired (e.g. the worker crashed mid-step) become claimable again.
+	ClaimNext(ctx context.Context, lockTimeout time.Duration) (*models.OutboxEntry, error)
+	MarkDone(ctx context.Context, id primitive.ObjectID) error
+	MarkFailed(ctx context.Context, id primitive.ObjectID, lastError string) error
+	Reschedule(ctx context.Context, id primitive.ObjectID, nextAttemptAt time.Time, lastError string) error
+	EnsureIndexes(ctx context.Context) error
+}
+
+type outboxRepository struct {
+	collection *mongo.Collection
+	timeouts   config.TimeoutConfig
+}
+
+func NewOutboxRepository(db *mongo.Database, timeouts config.TimeoutConfig) OutboxRepository {
+	return &outboxRepository{
+		collection: db.Collection("outbox"),
+		timeouts:   timeouts,
+	}
+}
+
+func (r *outboxRepository) Create(ctx context.Context, entry *models.OutboxEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	now := time.Now()
+	entry.Status = models.OutboxStatusPending
+	entry.CreatedAt = now
+	entry.UpdatedAt = now
+	if entry.NextAttemptAt.IsZero() {
+		entry.NextAttemptAt = now
+	}
+
+	result, err := r.collection.InsertOne(ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *outboxRepository) ClaimNext(ctx context.Context, lockTimeout time.Duration) (*models.OutboxEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"next_attempt_at": bson.M{"$lte": now},
+		"$or": bson.A{
+			bson.M{"status": models.OutboxStatusPending},
+			bson.M{"status": models.OutboxStatusProcessing, "locked_until": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":       models.OutboxStatusProcessing,
+			"locked_until": now.Add(lockTimeout),
+			"updated_at":   now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var entry models.OutboxEntry
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&entry); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func (r *outboxRepository) MarkDone(ctx context.Context, id primitive.ObjectID) error {
+	return r.setStatus(ctx, id, bson.M{"status": models.OutboxStatusDone})
+}
+
+func (r *outboxRepository) MarkFailed(ctx context.Context, id primitive.ObjectID, lastError string) error {
+	return r.setStatus(ctx, id, bson.M{"status": models.OutboxStatusFailed, "last_error": lastError})
+}
+
+func (r *outboxRepository) Reschedule(ctx context.Context, id primitive.ObjectID, nextAttemptAt time.Time, lastError string) error {
+	return r.setStatus(ctx, id, bson.M{
+		"status":          models.OutboxStatusPending,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	})
+}
+
+func (r *outboxRepository) setStatus(ctx context.Context, id primitive.ObjectID, fields bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	fields["updated_at"] = time.Now()
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *outboxRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Maintenance)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+	})
+	return err
+}
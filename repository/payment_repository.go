@@ -2,30 +2,51 @@ package repository
 
 import (
 	"context"
+	"p3-graded-challenge-1-ziancarlos/config"
 	"p3-graded-challenge-1-ziancarlos/models"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type PaymentRepository interface {
-	Create(payment *models.Payment) error
+	Create(ctx context.Context, payment *models.Payment) error
+	FindAll(ctx context.Context, filter *models.PaymentFilter) ([]models.Payment, int64, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error)
+	UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to string) error
+	// ApplyRefund records a refund only if the payment still has the status and
+	// refunded amount it was read with, so concurrent refunds cannot overshoot.
+	ApplyRefund(ctx context.Context, id primitive.ObjectID, fromStatus string, fromRefunded models.Money, toStatus string, toRefunded models.Money) error
+	// BackfillStatus marks payments stored before statuses existed as captured,
+	// which every stored payment then was, and reports how many it changed.
+	BackfillStatus(ctx context.Context) (int64, error)
+	// MigrateLegacyMoney rewrites amounts and refunded amounts stored as a bare number before Money
+	// existed, and reports how many fields it changed.
+	MigrateLegacyMoney(ctx context.Context) (int64, error)
+	EnsureIndexes(ctx context.Context) error
 }
 
 type paymentRepository struct {
 	collection *mongo.Collection
+	timeouts   config.TimeoutConfig
 }
 
-func NewPaymentRepository(db *mongo.Database) PaymentRepository {
+func NewPaymentRepository(db *mongo.Database, timeouts config.TimeoutConfig) PaymentRepository {
 	return &paymentRepository{
 		collection: db.Collection("payments"),
+		timeouts:   timeouts,
 	}
 }
 
-func (r *paymentRepository) Create(payment *models.Payment) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (r *paymentRepository) Create(ctx context.Context, payment *models.Payment) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
+	now := time.Now()
+	payment.CreatedAt = now
+	payment.UpdatedAt = now
 	result, err := r.collection.InsertOne(ctx, payment)
 	if err != nil {
 		return err
@@ -33,3 +54,126 @@ func (r *paymentRepository) Create(payment *models.Payment) error {
 	payment.ID = result.InsertedID.(primitive.ObjectID)
 	return nil
 }
+
+func (r *paymentRepository) FindAll(ctx context.Context, filter *models.PaymentFilter) ([]models.Payment, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+
+	query := bson.M{}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.TransactionID != "" {
+		query["transaction_id"] = filter.TransactionID
+	}
+	if filter.OrderID != "" {
+		query["order_id"] = filter.OrderID
+	}
+	dateRange := bson.M{}
+	if !filter.From.IsZero() {
+		dateRange["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		dateRange["$lt"] = filter.To
+	}
+	if len(dateRange) > 0 {
+		query["created_at"] = dateRange
+	}
+	addMoneyRange(query, "amount", filter.MinAmount, filter.MaxAmount)
+
+	total, err := r.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(filter.Skip).
+		SetLimit(filter.Limit)
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var payments []models.Payment
+	if err = cursor.All(ctx, &payments); err != nil {
+		return nil, 0, err
+	}
+	return payments, total, nil
+}
+
+func (r *paymentRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	var payment models.Payment
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func (r *paymentRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": from},
+		bson.M{"$set": bson.M{"status": to, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *paymentRepository) ApplyRefund(ctx context.Context, id primitive.ObjectID, fromStatus string, fromRefunded models.Money, toStatus string, toRefunded models.Money) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	var refunded interface{} = fromRefunded.Amount
+	if fromRefunded.Amount == 0 {
+		// Payments stored before refunds existed have no refunded amount at all
+		refunded = bson.M{"$in": bson.A{0, nil}}
+	}
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": fromStatus, "refunded_amount.amount": refunded},
+		bson.M{"$set": bson.M{"status": toStatus, "refunded_amount": toRefunded, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *paymentRepository) BackfillStatus(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Maintenance)
+	defer cancel()
+
+	filter := bson.M{"status": bson.M{"$in": bson.A{nil, ""}}}
+	result, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"status": models.PaymentStatusCaptured}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func (r *paymentRepository) MigrateLegacyMoney(ctx context.Context) (int64, error) {
+	return migrateLegacyMoney(ctx, r.collection, r.timeouts.Maintenance, "amount", "refunded_amount")
+}
+
+func (r *paymentRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Maintenance)
+	defer cancel()
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "transaction_id", Value: 1}}},
+		{Keys: bson.D{{Key: "order_id", Value: 1}}},
+	})
+	return err
+}
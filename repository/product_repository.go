@@ -2,34 +2,61 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"p3-graded-challenge-1-ziancarlos/config"
 	"p3-graded-challenge-1-ziancarlos/models"
+	"regexp"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ProductRepository interface {
-	Create(product *models.Product) error
-	FindAll() ([]models.Product, error)
-	FindByID(id primitive.ObjectID) (*models.Product, error)
-	Update(id primitive.ObjectID, update *models.ProductRequest) error
-	Delete(id primitive.ObjectID) error
+	Create(ctx context.Context, product *models.Product) error
+	FindAll(ctx context.Context, filter *models.ProductFilter) ([]models.Product, int64, error)
+	// FindByID and FindByIDs skip soft deleted products
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Product, error)
+	FindByIDIncludingDeleted(ctx context.Context, id primitive.ObjectID) (*models.Product, error)
+	FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.Product, error)
+	Update(ctx context.Context, id primitive.ObjectID, update *models.ProductRequest) error
+	// AdjustStock moves units in and out of the available and reserved counts
+	AdjustStock(ctx context.Context, id primitive.ObjectID, stockDelta, reservedDelta int64) (*models.Product, error)
+	// Delete soft deletes the product; Restore brings it back
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	Restore(ctx context.Context, id primitive.ObjectID) error
+	// Archive soft deletes a product that other records still point at. The
+	// reason is kept and archived products are never purged.
+	Archive(ctx context.Context, id primitive.ObjectID, reason string) error
+	// PurgeDeleted removes products soft deleted before the given time for
+	// good, skipping archived ones
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	// MigrateLegacyMoney rewrites prices stored as a bare number before Money
+	// existed, and reports how many it it changed.
+	MigrateLegacyMoney(ctx context.Context) (int64, error)
+	EnsureIndexes(ctx context.Context) error
 }
 
+// ErrInsufficientStock is returned by AdjustStock when the change would take
+// the available or reserved count below zero.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
 type productRepository struct {
 	collection *mongo.Collection
+	timeouts   config.TimeoutConfig
 }
 
-func NewProductRepository(db *mongo.Database) ProductRepository {
+func NewProductRepository(db *mongo.Database, timeouts config.TimeoutConfig) ProductRepository {
 	return &productRepository{
 		collection: db.Collection("products"),
+		timeouts:   timeouts,
 	}
 }
 
-func (r *productRepository) Create(product *models.Product) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (r *productRepository) Create(ctx context.Context, product *models.Product) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
 
 	result, err := r.collection.InsertOne(ctx, product)
@@ -41,30 +68,68 @@ func (r *productRepository) Create(product *models.Product) error {
 	return nil
 }
 
-func (r *productRepository) FindAll() ([]models.Product, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (r *productRepository) FindAll(ctx context.Context, filter *models.ProductFilter) ([]models.Product, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
 	defer cancel()
 
-	cursor, err := r.collection.Find(ctx, bson.M{})
+	query := bson.M{}
+	if !filter.IncludeDeleted {
+		query["deleted_at"] = notDeleted
+	}
+	if filter.Name != "" {
+		query["name"] = bson.M{"$regex": regexp.QuoteMeta(filter.Name), "$options": "i"}
+	}
+	addMoneyRange(query, "price", filter.MinPrice, filter.MaxPrice)
+
+	// Total ignores the cursor so it always reflects the whole result set
+	total, err := r.collection.CountDocuments(ctx, query)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	if !filter.After.IsZero() {
+		query["_id"] = bson.M{"$gt": filter.After}
+	}
+
+	opts := options.Find().
+		SetSort(productSort(filter.Sort)).
+		SetSkip(filter.Skip).
+		SetLimit(filter.Limit)
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
 	}
 	defer cursor.Close(ctx)
 
 	var products []models.Product
 	if err = cursor.All(ctx, &products); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return products, nil
+	return products, total, nil
+}
+
+// productSort always ends with _id so pages are stable when the sort key ties.
+func productSort(sort string) bson.D {
+	switch sort {
+	case "price":
+		return bson.D{{Key: "price.amount", Value: 1}, {Key: "_id", Value: 1}}
+	case "-price":
+		return bson.D{{Key: "price.amount", Value: -1}, {Key: "_id", Value: 1}}
+	case "name":
+		return bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}
+	default:
+		return bson.D{{Key: "_id", Value: 1}}
+	}
 }
 
-func (r *productRepository) FindByID(id primitive.ObjectID) (*models.Product, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (r *productRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Read)
 	defer cancel()
 
 	var product models.Product
-	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&product)
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "deleted_at": notDeleted}).Decode(&product)
 	if err != nil {
 		return nil, err
 	}
@@ -72,8 +137,36 @@ func (r *productRepository) FindByID(id primitive.ObjectID) (*models.Product, er
 	return &product, nil
 }
 
-func (r *productRepository) Update(id primitive.ObjectID, update *models.ProductRequest) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (r *productRepository) FindByIDIncludingDeleted(ctx context.Context, id primitive.ObjectID) (*models.Product, error) {
+	var product models.Product
+	if err := findByIDIncludingDeleted(ctx, r.collection, r.timeouts.Read, id, &product); err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// FindByIDs returns the products that exist among ids, in no particular order.
+func (r *productRepository) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "deleted_at": notDeleted})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+	if err = cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+func (r *productRepository) Update(ctx context.Context, id primitive.ObjectID, update *models.ProductRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
 
 	updateDoc := bson.M{
@@ -83,7 +176,7 @@ func (r *productRepository) Update(id primitive.ObjectID, update *models.Product
 		},
 	}
 
-	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, updateDoc)
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "deleted_at": notDeleted}, updateDoc)
 	if err != nil {
 		return err
 	}
@@ -95,19 +188,69 @@ func (r *productRepository) Update(id primitive.ObjectID, update *models.Product
 	return nil
 }
 
-func (r *productRepository) Delete(id primitive.ObjectID) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// AdjustStock adds the deltas (which may be negative) to the product's stock
+// and reserved counts and returns the updated product. The check and the
+// update are a single conditional write, so concurrent purchases can never
+// take either count below zero. Units are only taken out of the stock of
+// products that are not soft deleted; putting them back always works.
+func (r *productRepository) AdjustStock(ctx context.Context, id primitive.ObjectID, stockDelta, reservedDelta int64) (*models.Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
 
-	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
-	if err != nil {
-		return err
+	filter := bson.M{"_id": id}
+	if stockDelta < 0 {
+		filter["stock"] = bson.M{"$gte": -stockDelta}
+		filter["deleted_at"] = notDeleted
+	}
+	if reservedDelta < 0 {
+		filter["reserved"] = bson.M{"$gte": -reservedDelta}
 	}
+	update := bson.M{"$inc": bson.M{"stock": stockDelta, "reserved": reservedDelta}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
-	if result.DeletedCount == 0 {
-		return mongo.ErrNoDocuments
+	var product models.Product
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&product)
+	if err == mongo.ErrNoDocuments && (stockDelta < 0 || reservedDelta < 0) {
+		// Tell a missing or deleted product apart from one without enough stock
+		if _, findErr := r.FindByID(ctx, id); findErr != nil {
+			return nil, findErr
+		}
+		return nil, ErrInsufficientStock
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &product, nil
+}
+
+func (r *productRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return softDelete(ctx, r.collection, r.timeouts.Write, id, nil, nil)
+}
+
+func (r *productRepository) Archive(ctx context.Context, id primitive.ObjectID, reason string) error {
+	return softDelete(ctx, r.collection, r.timeouts.Write, id, nil, bson.M{"archived": true, "delete_reason": reason})
+}
+
+func (r *productRepository) Restore(ctx context.Context, id primitive.ObjectID) error {
+	return restoreDeleted(ctx, r.collection, r.timeouts.Write, id, "archived", "delete_reason")
 }
 
+func (r *productRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return purgeDeleted(ctx, r.collection, r.timeouts.Maintenance, before, bson.M{"archived": bson.M{"$ne": true}})
+}
+
+func (r *productRepository) MigrateLegacyMoney(ctx context.Context) (int64, error) {
+	return migrateLegacyMoney(ctx, r.collection, r.timeouts.Maintenance, "price")
+}
+
+func (r *productRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Maintenance)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	return err
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RefundRepository interface {
+	Create(ctx context.Context, refund *models.Refund) error
+	FindByPaymentID(ctx context.Context, paymentID primitive.ObjectID) ([]models.Refund, error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// MigrateLegacyMoney rewrites amounts stored as a bare number before Money
+	// existed, and reports how many it it changed.
+	MigrateLegacyMoney(ctx context.Context) (int64, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type refundRepository struct {
+	collection *mongo.Collection
+	timeouts   config.TimeoutConfig
+}
+
+func NewRefundRepository(db *mongo.Database, timeouts config.TimeoutConfig) RefundRepository {
+	return &refundRepository{
+		collection: db.Collection("refunds"),
+		timeouts:   timeouts,
+	}
+}
+
+func (r *refundRepository) Create(ctx context.Context, refund *models.Refund) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	refund.CreatedAt = time.Now()
+	result, err := r.collection.InsertOne(ctx, refund)
+	if err != nil {
+		return err
+	}
+	refund.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *refundRepository) FindByPaymentID(ctx context.Context, paymentID primitive.ObjectID) ([]models.Refund, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"payment_id": paymentID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var refunds []models.Refund
+	if err = cursor.All(ctx, &refunds); err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
+
+func (r *refundRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *refundRepository) MigrateLegacyMoney(ctx context.Context) (int64, error) {
+	return migrateLegacyMoney(ctx, r.collection, r.timeouts.Maintenance, "amount")
+}
+
+func (r *refundRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Maintenance)
+	defer cancel()
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "payment_id", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	return err
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ReservationRepository interface {
+	Create(ctx context.Context, reservation *models.Reservation) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Reservation, error)
+	// Attach hands an active, unexpired and unclaimed reservation to a
+	// transaction and moves its expiry to expiresAt. Reservations already
+	// claimed by a transaction or an order are left alone.
+	Attach(ctx context.Context, id, transactionID primitive.ObjectID, expiresAt time.Time) (*models.Reservation, error)
+	// UpdateStatus only succeeds while the reservation is still in status from.
+	UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to string) error
+	FindExpired(ctx context.Context, now time.Time, limit int64) ([]models.Reservation, error)
+	// ActiveQuantity sums the units of the product held in active, unexpired
+	// reservations made by createdBy.
+	ActiveQuantity(ctx context.Context, createdBy string, productID primitive.ObjectID) (int64, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type reservationRepository struct {
+	collection *mongo.Collection
+	timeouts   config.TimeoutConfig
+}
+
+func NewReservationRepository(db *mongo.Database, timeouts config.TimeoutConfig) ReservationRepository {
+	return &reservationRepository{
+		collection: db.Collection("reservations"),
+		timeouts:   timeouts,
+	}
+}
+
+func (r *reservationRepository) Create(ctx context.Context, reservation *models.Reservation) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	now := time.Now()
+	reservation.Status = models.ReservationStatusActive
+	reservation.CreatedAt = now
+	reservation.UpdatedAt = now
+
+	result, err := r.collection.InsertOne(ctx, reservation)
+	if err != nil {
+		return err
+	}
+
+	reservation.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *reservationRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	var reservation models.Reservation
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&reservation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+func (r *reservationRepository) Attach(ctx context.Context, id, transactionID primitive.ObjectID, expiresAt time.Time) (*models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"_id":            id,
+		"status":         models.ReservationStatusActive,
+		"transaction_id": bson.M{"$exists": false},
+		"order_id":       bson.M{"$exists": false},
+		"expires_at":     bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{
+		"transaction_id": transactionID,
+		"expires_at":     expiresAt,
+		"updated_at":     now,
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var reservation models.Reservation
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&reservation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+func (r *reservationRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"status": to, "updated_at": time.Now()}}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": from}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *reservationRepository) FindExpired(ctx context.Context, now time.Time, limit int64) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+
+	filter := bson.M{
+		"status":     models.ReservationStatusActive,
+		"expires_at": bson.M{"$lte": now},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "expires_at", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var reservations []models.Reservation
+	if err = cursor.All(ctx, &reservations); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+func (r *reservationRepository) ActiveQuantity(ctx context.Context, createdBy string, productID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"created_by": createdBy,
+			"product_id": productID,
+			"status":     models.ReservationStatusActive,
+			"expires_at": bson.M{"$gt": time.Now()},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "quantity": bson.M{"$sum": "$quantity"}}}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var totals []struct {
+		Quantity int64 `bson:"quantity"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return 0, err
+	}
+	if len(totals) == 0 {
+		return 0, nil
+	}
+
+	return totals[0].Quantity, nil
+}
+
+func (r *reservationRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Maintenance)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}}},
+		{Keys: bson.D{{Key: "created_by", Value: 1}, {Key: "product_id", Value: 1}, {Key: "status", Value: 1}}},
+	})
+	return err
+}
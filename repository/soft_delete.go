@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Soft deleted documents carry a deleted_at timestamp and are hidden from
+// reads unless asked for; they are removed for good by purgeDeleted.
+
+// notDeleted matches documents that have not been soft deleted.
+var notDeleted = bson.M{"$exists": false}
+
+// softDelete marks the document deleted, also setting any extra fields. An
+// optional extra filter limits which documents may be deleted.
+func softDelete(ctx context.Context, collection *mongo.Collection, timeout time.Duration, id primitive.ObjectID, filter, fields bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	set := bson.M{"deleted_at": time.Now()}
+	for key, value := range fields {
+		set[key] = value
+	}
+
+	query := bson.M{"_id": id, "deleted_at": notDeleted}
+	for key, value := range filter {
+		query[key] = value
+	}
+
+	result, err := collection.UpdateOne(ctx, query, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// restoreDeleted returns mongo.ErrNoDocuments unless the document exists and
+// is soft deleted. Extra fields set by softDelete are cleared as well.
+func restoreDeleted(ctx context.Context, collection *mongo.Collection, timeout time.Duration, id primitive.ObjectID, fields ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	unset := bson.M{"deleted_at": ""}
+	for _, field := range fields {
+		unset[field] = ""
+	}
+
+	filter := bson.M{"_id": id, "deleted_at": bson.M{"$exists": true}}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$unset": unset})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// purgeDeleted removes documents soft deleted before the given time, narrowed
+// by an optional extra filter.
+func purgeDeleted(ctx context.Context, collection *mongo.Collection, timeout time.Duration, before time.Time, filter bson.M) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	query := bson.M{"deleted_at": bson.M{"$lte": before}}
+	for key, value := range filter {
+		query[key] = value
+	}
+
+	result, err := collection.DeleteMany(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func findByIDIncludingDeleted(ctx context.Context, collection *mongo.Collection, timeout time.Duration, id primitive.ObjectID, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return collection.FindOne(ctx, bson.M{"_id": id}).Decode(out)
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type StockAdjustmentRepository interface {
+	Create(ctx context.Context, adjustment *models.StockAdjustment) error
+	FindByProductID(ctx context.Context, productID primitive.ObjectID) ([]models.StockAdjustment, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type stockAdjustmentRepository struct {
+	collection *mongo.Collection
+	timeouts   config.TimeoutConfig
+}
+
+func NewStockAdjustmentRepository(db *mongo.Database, timeouts config.TimeoutConfig) StockAdjustmentRepository {
+	return &stockAdjustmentRepository{
+		collection: db.Collection("stock_adjustments"),
+		timeouts:   timeouts,
+	}
+}
+
+func (r *stockAdjustmentRepository) Create(ctx context.Context, adjustment *models.StockAdjustment) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+	adjustment.CreatedAt = time.Now()
+	result, err := r.collection.InsertOne(ctx, adjustment)
+	if err != nil {
+		return err
+	}
+	adjustment.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *stockAdjustmentRepository) FindByProductID(ctx context.Context, productID primitive.ObjectID) ([]models.StockAdjustment, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"product_id": productID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var adjustments []models.StockAdjustment
+	if err = cursor.All(ctx, &adjustments); err != nil {
+		return nil, err
+	}
+	return adjustments, nil
+}
+
+func (r *stockAdjustmentRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Maintenance)
+	defer cancel()
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "product_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	return err
+}
@@ -1,12 +1,7 @@
 package repository
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
 	"p3-graded-challenge-1-ziancarlos/config"
 	"p3-graded-challenge-1-ziancarlos/models"
 	"time"
@@ -18,100 +13,116 @@ import (
 )
 
 type TransactionRepository interface {
-	Create(transaction *models.Transaction) error
-	FindAll() ([]models.Transaction, error)
-	FindByID(id primitive.ObjectID) (*models.Transaction, error)
-	Update(id primitive.ObjectID, update bson.M) error
-	Delete(id primitive.ObjectID) error
+	Create(ctx context.Context, transaction *models.Transaction) error
+	FindAll(ctx context.Context, filter *models.TransactionFilter) ([]models.Transaction, error)
+	// FindByID skips soft deleted transactions
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Transaction, error)
+	FindByIDIncludingDeleted(ctx context.Context, id primitive.ObjectID) (*models.Transaction, error)
+	// Update sets fields while the transaction is still in status and not
+	// deleted, returning mongo.ErrNoDocuments if it has moved on.
+	Update(ctx context.Context, id primitive.ObjectID, status string, update bson.M) error
+	// UpdateStatus moves a transaction from one status to another and appends
+	// the change to its history, returning mongo.ErrNoDocuments if it is no
+	// longer in the expected status or has been deleted. from == to only sets
+	// fields.
+	UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to, reason string, fields bson.M) error
+	// SetRefundedAmount raises the refunded total; it never lowers it, so a late
+	// reply for an earlier refund cannot overwrite a newer total.
+	SetRefundedAmount(ctx context.Context, id primitive.ObjectID, amount models.Money) error
+	// ExistsByProductID reports whether any transaction, soft deleted or not,
+	// points at the product.
+	ExistsByProductID(ctx context.Context, productID primitive.ObjectID) (bool, error)
+	// Delete soft deletes the transaction unless it is still pending, since
+	// the payment worker is working on it; Restore brings it back
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	Restore(ctx context.Context, id primitive.ObjectID) error
+	// PurgeDeleted removes transactions soft deleted before the given time for good
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	// BackfillStatus marks transactions stored before statuses existed as paid,
+	// which every stored transaction then was, and reports how many it changed.
+	BackfillStatus(ctx context.Context) (int64, error)
+	// MigrateLegacyMoney rewrites prices and refunded amounts stored as a bare number before Money
+	// existed, and reports how many fields it changed.
+	MigrateLegacyMoney(ctx context.Context) (int64, error)
+	EnsureIndexes(ctx context.Context) error
 }
 
 type transactionRepository struct {
 	collection *mongo.Collection
-	cfg        *config.Config
+	timeouts   config.TimeoutConfig
 }
 
-type PaymentRequest struct {
-	Amount float64 `json:"amount"`
-}
-
-type PaymentResponse struct {
-	ID     string  `json:"id"`
-	Amount float64 `json:"amount"`
-}
-
-func NewTransactionRepository(db *mongo.Database, cfg *config.Config) TransactionRepository {
+func NewTransactionRepository(db *mongo.Database, timeouts config.TimeoutConfig) TransactionRepository {
 	return &transactionRepository{
 		collection: db.Collection("transactions"),
-		cfg:        cfg,
+		timeouts:   timeouts,
 	}
 }
 
-func (r *transactionRepository) Create(transaction *models.Transaction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// Create stores a new transaction as pending; the payment worker settles it.
+func (r *transactionRepository) Create(ctx context.Context, transaction *models.Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
 
-	// HTTP call ke payment service
-	paymentReq := PaymentRequest{
-		Amount: transaction.Price,
+	transaction.Date = time.Now()
+	transaction.Status = models.TransactionStatusPending
+	transaction.StatusHistory = []models.StatusChange{
+		{Status: models.TransactionStatusPending, ChangedAt: transaction.Date},
 	}
 
-	jsonData, err := json.Marshal(paymentReq)
+	result, err := r.collection.InsertOne(ctx, transaction)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payment request: %w", err)
+		return err
 	}
 
-	paymentURL := fmt.Sprintf("%s/payments", r.cfg.PaymentService.BaseURI)
-	req, err := http.NewRequestWithContext(ctx, "POST", paymentURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create payment request: %w", err)
-	}
+	transaction.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
+func (r *transactionRepository) FindAll(ctx context.Context, filter *models.TransactionFilter) ([]models.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.List)
+	defer cancel()
 
-	client := &http.Client{
-		Timeout: 5 * time.Second,
+	query := bson.M{}
+	if !filter.IncludeDeleted {
+		query["deleted_at"] = notDeleted
 	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to call payment service: %w", err)
+	if !filter.ProductID.IsZero() {
+		query["product_id"] = filter.ProductID
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusCreated {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("payment service returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	if filter.PaymentMethod != "" {
+		query["payment_method"] = filter.PaymentMethod
 	}
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read payment response: %w", err)
+	if filter.CreatedBy != "" {
+		query["created_by"] = filter.CreatedBy
 	}
 
-	var paymentResp PaymentResponse
-	if err := json.Unmarshal(bodyBytes, &paymentResp); err != nil {
-		return fmt.Errorf("failed to unmarshal payment response: %w", err)
+	dateRange := bson.M{}
+	if !filter.From.IsZero() {
+		dateRange["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		dateRange["$lt"] = filter.To
+	}
+	if len(dateRange) > 0 {
+		query["date"] = dateRange
 	}
 
-	// Simpan payment ID ke transaction
-	transaction.PaymentID = paymentResp.ID
-	transaction.Date = time.Now()
+	addMoneyRange(query, "price", filter.MinPrice, filter.MaxPrice)
 
-	result, err := r.collection.InsertOne(ctx, transaction)
-	if err != nil {
-		return err
+	// Keyset pagination: everything strictly after the cursor in (date, _id) desc order
+	if !filter.CursorID.IsZero() {
+		query["$or"] = bson.A{
+			bson.M{"date": bson.M{"$lt": filter.CursorDate}},
+			bson.M{"date": filter.CursorDate, "_id": bson.M{"$lt": filter.CursorID}},
+		}
 	}
 
-	transaction.ID = result.InsertedID.(primitive.ObjectID)
-	return nil
-}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(filter.Limit)
 
-func (r *transactionRepository) FindAll() ([]models.Transaction, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}})
-	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	cursor, err := r.collection.Find(ctx, query, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -125,12 +136,12 @@ func (r *transactionRepository) FindAll() ([]models.Transaction, error) {
 	return transactions, nil
 }
 
-func (r *transactionRepository) FindByID(id primitive.ObjectID) (*models.Transaction, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (r *transactionRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Read)
 	defer cancel()
 
 	var transaction models.Transaction
-	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&transaction)
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "deleted_at": notDeleted}).Decode(&transaction)
 	if err != nil {
 		return nil, err
 	}
@@ -138,13 +149,22 @@ func (r *transactionRepository) FindByID(id primitive.ObjectID) (*models.Transac
 	return &transaction, nil
 }
 
-func (r *transactionRepository) Update(id primitive.ObjectID, update bson.M) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (r *transactionRepository) FindByIDIncludingDeleted(ctx context.Context, id primitive.ObjectID) (*models.Transaction, error) {
+	var transaction models.Transaction
+	if err := findByIDIncludingDeleted(ctx, r.collection, r.timeouts.Read, id, &transaction); err != nil {
+		return nil, err
+	}
+
+	return &transaction, nil
+}
+
+func (r *transactionRepository) Update(ctx context.Context, id primitive.ObjectID, status string, update bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
 
 	updateDoc := bson.M{"$set": update}
 
-	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, updateDoc)
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": status, "deleted_at": notDeleted}, updateDoc)
 	if err != nil {
 		return err
 	}
@@ -156,19 +176,101 @@ func (r *transactionRepository) Update(id primitive.ObjectID, update bson.M) err
 	return nil
 }
 
-func (r *transactionRepository) Delete(id primitive.ObjectID) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (r *transactionRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to, reason string, fields bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
 	defer cancel()
 
-	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	set := bson.M{"status": to}
+	for k, v := range fields {
+		set[k] = v
+	}
+	update := bson.M{"$set": set}
+	if from != to {
+		update["$push"] = bson.M{"status_history": models.StatusChange{
+			Status:    to,
+			Reason:    reason,
+			ChangedAt: time.Now(),
+		}}
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": from, "deleted_at": notDeleted}, update)
 	if err != nil {
 		return err
 	}
 
-	if result.DeletedCount == 0 {
+	if result.MatchedCount == 0 {
 		return mongo.ErrNoDocuments
 	}
 
 	return nil
 }
 
+func (r *transactionRepository) SetRefundedAmount(ctx context.Context, id primitive.ObjectID, amount models.Money) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	filter := bson.M{
+		"_id": id,
+		"$or": bson.A{
+			bson.M{"refunded_amount.amount": bson.M{"$lt": amount.Amount}},
+			bson.M{"refunded_amount.amount": bson.M{"$exists": false}},
+		},
+	}
+	_, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"refunded_amount": amount}})
+	return err
+}
+
+func (r *transactionRepository) ExistsByProductID(ctx context.Context, productID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	count, err := r.collection.CountDocuments(ctx, bson.M{"product_id": productID}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *transactionRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	notPending := bson.M{"status": bson.M{"$ne": models.TransactionStatusPending}}
+	return softDelete(ctx, r.collection, r.timeouts.Write, id, notPending, nil)
+}
+
+func (r *transactionRepository) Restore(ctx context.Context, id primitive.ObjectID) error {
+	return restoreDeleted(ctx, r.collection, r.timeouts.Write, id)
+}
+
+func (r *transactionRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return purgeDeleted(ctx, r.collection, r.timeouts.Maintenance, before, nil)
+}
+
+func (r *transactionRepository) BackfillStatus(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Maintenance)
+	defer cancel()
+
+	filter := bson.M{"status": bson.M{"$in": bson.A{nil, ""}}}
+	result, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"status": models.TransactionStatusPaid}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func (r *transactionRepository) MigrateLegacyMoney(ctx context.Context) (int64, error) {
+	return migrateLegacyMoney(ctx, r.collection, r.timeouts.Maintenance, "price", "refunded_amount")
+}
+
+func (r *transactionRepository) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeouts.Maintenance)
+	defer cancel()
+
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "product_id", Value: 1}, {Key: "date", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "created_by", Value: 1}, {Key: "date", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	return err
+}
@@ -0,0 +1,68 @@
+// Package response defines the JSON envelope shared by the shopping and
+// payment servers, so that clients can read both the same way. Every body
+// carries the request ID set by Echo's RequestID middleware; list bodies carry
+// the pagination metadata in meta.
+package response
+
+import (
+	"p3-graded-challenge-1-ziancarlos/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Success struct {
+	Message   string           `json:"message"`
+	Data      interface{}      `json:"data,omitempty"`
+	Meta      *models.PageMeta `json:"meta,omitempty"`
+	RequestID string           `json:"request_id,omitempty"`
+}
+
+type Error struct {
+	Message string `json:"message"`
+	// Code is a stable machine-readable error code, e.g. product_not_found
+	Code  string `json:"code"`
+	Error string `json:"error,omitempty"`
+	// Errors lists the fields that failed validation
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// FieldError describes one field that failed validation.
+type FieldError struct {
+	// Field is the JSON or query name, with the path for nested fields, e.g. items[0].quantity
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// JSON writes a success envelope; data may be nil.
+func JSON(c echo.Context, status int, message string, data interface{}) error {
+	return c.JSON(status, Success{
+		Message:   message,
+		Data:      data,
+		RequestID: RequestID(c),
+	})
+}
+
+// Page writes a success envelope for one page of a list.
+func Page(c echo.Context, status int, message string, data interface{}, meta *models.PageMeta) error {
+	return c.JSON(status, Success{
+		Message:   message,
+		Data:      data,
+		Meta:      meta,
+		RequestID: RequestID(c),
+	})
+}
+
+// Fail writes an error envelope.
+func Fail(c echo.Context, status int, body Error) error {
+	body.RequestID = RequestID(c)
+	return c.JSON(status, body)
+}
+
+// RequestID returns the ID of the current request, or "" when the RequestID
+// middleware is not installed.
+func RequestID(c echo.Context) string {
+	return c.Response().Header().Get(echo.HeaderXRequestID)
+}
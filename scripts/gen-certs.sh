@@ -0,0 +1,60 @@
+#!/bin/sh
+# Generates a local CA and the certificates for running both services over
+# TLS, with the payment service requiring the shopping service's client
+# certificate. For local testing only; the keys are written unencrypted.
+# The CA key is deleted once the certificates are issued, so nothing else can
+# be signed with it; run the script again to start over with a new CA.
+#
+#   scripts/gen-certs.sh [output dir]   (default: certs)
+#
+# Then start the stack with TLS:
+#
+#   docker compose -f docker-compose.yml -f docker-compose.tls.yml up --build
+#
+# or run the servers directly with:
+#
+#   PAYMENT_TLS_CERT_FILE=certs/payment.crt PAYMENT_TLS_KEY_FILE=certs/payment.key \
+#   PAYMENT_TLS_CLIENT_CA_FILE=certs/ca.crt go run ./app/payment-server
+#
+#   SHOPPING_TLS_CERT_FILE=certs/shopping.crt SHOPPING_TLS_KEY_FILE=certs/shopping.key \
+#   PAYMENT_SERVICE_BASE_URI=https://localhost:9061 PAYMENT_SERVICE_CA_FILE=certs/ca.crt \
+#   PAYMENT_SERVICE_CLIENT_CERT_FILE=certs/shopping-client.crt \
+#   PAYMENT_SERVICE_CLIENT_KEY_FILE=certs/shopping-client.key go run ./app/http-server
+set -eu
+
+out=${1:-certs}
+days=825
+mkdir -p "$out"
+cd "$out"
+
+openssl req -x509 -newkey rsa:2048 -nodes -sha256 -days "$days" \
+	-keyout ca.key -out ca.crt -subj "/CN=shopping-local-ca"
+
+# issue <name> <common name> <extended key usage> [subject alt names]
+issue() {
+	name=$1
+	cn=$2
+	usage=$3
+	san=${4:-}
+
+	ext=$(mktemp)
+	printf 'basicConstraints=CA:FALSE\nkeyUsage=digitalSignature,keyEncipherment\nextendedKeyUsage=%s\n' "$usage" >"$ext"
+	if [ -n "$san" ]; then
+		printf 'subjectAltName=%s\n' "$san" >>"$ext"
+	fi
+
+	openssl req -newkey rsa:2048 -nodes -sha256 \
+		-keyout "$name.key" -out "$name.csr" -subj "/CN=$cn"
+	openssl x509 -req -sha256 -days "$days" -in "$name.csr" \
+		-CA ca.crt -CAkey ca.key -CAcreateserial -extfile "$ext" -out "$name.crt"
+	rm -f "$name.csr" "$ext"
+}
+
+issue payment payment-service serverAuth "DNS:payment-service,DNS:localhost,IP:127.0.0.1"
+issue shopping shopping-service serverAuth "DNS:shopping-service,DNS:localhost,IP:127.0.0.1"
+issue shopping-client shopping-service clientAuth
+rm -f ca.key ca.srl
+
+# The services run as a non-root user in some setups; let them read the keys
+chmod 644 payment.key shopping.key shopping-client.key
+echo "Certificates written to $(pwd)"
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"p3-graded-challenge-1-ziancarlos/auth"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/repository"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CartService interface {
+	CreateCart(ctx context.Context, req *models.CartRequest) (*models.CartResponse, error)
+	GetCart(ctx context.Context, id string) (*models.CartResponse, error)
+	AddItem(ctx context.Context, id string, req *models.CartItemRequest) (*models.CartResponse, error)
+	UpdateItem(ctx context.Context, id, productID string, req *models.CartItemUpdateRequest) (*models.CartResponse, error)
+	RemoveItem(ctx context.Context, id, productID string) (*models.CartResponse, error)
+	Checkout(ctx context.Context, id string, req *models.CheckoutRequest) (*models.OrderResponse, error)
+}
+
+type cartService struct {
+	repo         repository.CartRepository
+	productRepo  repository.ProductRepository
+	orderService OrderService
+	policy       *auth.Policy
+	cfg          *config.Config
+}
+
+func NewCartService(repo repository.CartRepository, productRepo repository.ProductRepository, orderService OrderService, policy *auth.Policy, cfg *config.Config) CartService {
+	return &cartService{
+		repo:         repo,
+		productRepo:  productRepo,
+		orderService: orderService,
+		policy:       policy,
+		cfg:          cfg,
+	}
+}
+
+func (s *cartService) CreateCart(ctx context.Context, req *models.CartRequest) (*models.CartResponse, error) {
+	cart := &models.Cart{CreatedBy: auth.Subject(ctx), ExpiresAt: s.expiry()}
+
+	// Lines for the same product are merged, as AddItem would
+	lines := map[primitive.ObjectID]int{}
+	for _, item := range req.Items {
+		productID, err := s.findProduct(ctx, item.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		if idx, ok := lines[productID]; ok {
+			cart.Items[idx].Quantity += item.Quantity
+			if cart.Items[idx].Quantity > models.MaxItemQuantity {
+				return nil, fmt.Errorf("%w: at most %d units per product", ErrQuantityTooLarge, models.MaxItemQuantity)
+			}
+			continue
+		}
+		lines[productID] = len(cart.Items)
+		cart.Items = append(cart.Items, models.CartItem{ProductID: productID, Quantity: item.Quantity})
+	}
+
+	if err := s.repo.Create(ctx, cart); err != nil {
+		return nil, err
+	}
+
+	return s.toCartResponse(ctx, cart)
+}
+
+func (s *cartService) GetCart(ctx context.Context, id string) (*models.CartResponse, error) {
+	cartID, err := parseCartID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := s.findCart(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toCartResponse(ctx, cart)
+}
+
+func (s *cartService) AddItem(ctx context.Context, id string, req *models.CartItemRequest) (*models.CartResponse, error) {
+	cartID, err := parseCartID(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.findCart(ctx, cartID); err != nil {
+		return nil, err
+	}
+	productID, err := s.findProduct(ctx, req.ProductID)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := s.repo.AddItem(ctx, cartID, productID, req.Quantity, s.expiry())
+	if err != nil {
+		return nil, cartError(err)
+	}
+
+	return s.toCartResponse(ctx, cart)
+}
+
+func (s *cartService) UpdateItem(ctx context.Context, id, productID string, req *models.CartItemUpdateRequest) (*models.CartResponse, error) {
+	cartID, itemID, err := parseCartItemIDs(id, productID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.findCart(ctx, cartID); err != nil {
+		return nil, err
+	}
+
+	cart, err := s.repo.SetItemQuantity(ctx, cartID, itemID, req.Quantity, s.expiry())
+	if err != nil {
+		return nil, cartError(err)
+	}
+
+	return s.toCartResponse(ctx, cart)
+}
+
+func (s *cartService) RemoveItem(ctx context.Context, id, productID string) (*models.CartResponse, error) {
+	cartID, itemID, err := parseCartItemIDs(id, productID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.findCart(ctx, cartID); err != nil {
+		return nil, err
+	}
+
+	cart, err := s.repo.RemoveItem(ctx, cartID, itemID, s.expiry())
+	if err != nil {
+		return nil, cartError(err)
+	}
+
+	return s.toCartResponse(ctx, cart)
+}
+
+// Checkout turns the cart into an order at the current catalog prices and
+// hands it to the regular order payment flow. The cart is claimed first so
+// it can only be checked out once; it is handed back if the order fails.
+func (s *cartService) Checkout(ctx context.Context, id string, req *models.CheckoutRequest) (*models.OrderResponse, error) {
+	cartID, err := parseCartID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := s.findCart(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+	if cart.Status != models.CartStatusActive {
+		return nil, ErrCartNotActive
+	}
+	if len(cart.Items) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	if err := s.repo.UpdateStatus(ctx, cartID, models.CartStatusActive, models.CartStatusCheckedOut, nil); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrCartNotActive
+		}
+		return nil, err
+	}
+
+	orderReq := &models.OrderRequest{PaymentMethod: req.PaymentMethod}
+	for _, item := range cart.Items {
+		orderReq.Items = append(orderReq.Items, models.OrderItemRequest{
+			ProductID: item.ProductID.Hex(),
+			Quantity:  item.Quantity,
+		})
+	}
+
+	order, err := s.orderService.CreateOrder(ctx, orderReq)
+	if err != nil {
+		if undoErr := s.repo.UpdateStatus(context.WithoutCancel(ctx), cartID, models.CartStatusCheckedOut, models.CartStatusActive, nil); undoErr != nil {
+			log.Printf("failed to reopen cart %s after failed checkout: %v", id, undoErr)
+		}
+		return nil, err
+	}
+
+	orderID, _ := primitive.ObjectIDFromHex(order.ID)
+	err = s.repo.UpdateStatus(ctx, cartID, models.CartStatusCheckedOut, models.CartStatusCheckedOut, bson.M{"order_id": orderID})
+	if err != nil {
+		log.Printf("failed to link cart %s to order %s: %v", id, order.ID, err)
+	}
+
+	return order, nil
+}
+
+// findCart loads the cart if the caller may use it. A cart never changes
+// hands, so checking before a change is as good as checking during it.
+func (s *cartService) findCart(ctx context.Context, id primitive.ObjectID) (*models.Cart, error) {
+	cart, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, cartError(err)
+	}
+	if !ownedBy(ctx, s.policy, auth.PermCartsReadAll, cart.CreatedBy) {
+		return nil, ErrCartNotFound
+	}
+	return cart, nil
+}
+
+func (s *cartService) expiry() time.Time {
+	return time.Now().Add(s.cfg.Cart.TTL)
+}
+
+// findProduct checks that the product exists before it goes into a cart.
+func (s *cartService) findProduct(ctx context.Context, id string) (primitive.ObjectID, error) {
+	productID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, ErrInvalidProductID
+	}
+	if _, err := s.productRepo.FindByID(ctx, productID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return primitive.NilObjectID, ErrProductNotFound
+		}
+		return primitive.NilObjectID, err
+	}
+	return productID, nil
+}
+
+func parseCartID(id string) (primitive.ObjectID, error) {
+	cartID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, ErrInvalidCartID
+	}
+	return cartID, nil
+}
+
+func parseCartItemIDs(id, productID string) (primitive.ObjectID, primitive.ObjectID, error) {
+	cartID, err := parseCartID(id)
+	if err != nil {
+		return cartID, primitive.NilObjectID, err
+	}
+	itemID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return cartID, itemID, ErrInvalidProductID
+	}
+	return cartID, itemID, nil
+}
+
+func cartError(err error) error {
+	switch err {
+	case mongo.ErrNoDocuments:
+		return ErrCartNotFound
+	case repository.ErrCartNotActive:
+		return ErrCartNotActive
+	case repository.ErrCartItemNotFound:
+		return ErrCartItemNotFound
+	case repository.ErrCartFull:
+		return fmt.Errorf("%w: at most %d products", ErrCartFull, models.MaxOrderItems)
+	case repository.ErrCartItemQuantity:
+		return fmt.Errorf("%w: at most %d units per product", ErrQuantityTooLarge, models.MaxItemQuantity)
+	}
+	return err
+}
+
+// toCartResponse prices every line from the current catalog.
+func (s *cartService) toCartResponse(ctx context.Context, cart *models.Cart) (*models.CartResponse, error) {
+	response := &models.CartResponse{
+		ID:        cart.ID.Hex(),
+		Items:     make([]models.CartItemResponse, 0, len(cart.Items)),
+		Status:    cart.Status,
+		CreatedBy: cart.CreatedBy,
+		CreatedAt: cart.CreatedAt,
+		UpdatedAt: cart.UpdatedAt,
+		ExpiresAt: cart.ExpiresAt,
+	}
+	if cart.OrderID != nil {
+		response.OrderID = cart.OrderID.Hex()
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		ids = append(ids, item.ProductID)
+	}
+	products := map[primitive.ObjectID]models.Product{}
+	if len(ids) > 0 {
+		found, err := s.productRepo.FindByIDs(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range found {
+			products[p.ID] = p
+		}
+	}
+
+	var total *models.Money
+	// A cart that mixes currencies or is too large to add up has no total
+	noTotal := false
+	for _, item := range cart.Items {
+		line := models.CartItemResponse{
+			ProductID: item.ProductID.Hex(),
+			Quantity:  item.Quantity,
+		}
+		product, ok := products[item.ProductID]
+		if !ok {
+			line.Unavailable = true
+			response.Items = append(response.Items, line)
+			continue
+		}
+
+		unitPrice := product.Price
+		line.Name = product.Name
+		line.UnitPrice = &unitPrice
+		line.Available = product.Stock
+		lineTotal, err := product.Price.Mul(item.Quantity)
+		if err != nil {
+			noTotal = true
+			response.Items = append(response.Items, line)
+			continue
+		}
+		line.LineTotal = &lineTotal
+		response.Items = append(response.Items, line)
+
+		if total == nil {
+			total = &lineTotal
+		} else if sum, err := total.Add(lineTotal); err == nil {
+			total = &sum
+		} else {
+			noTotal = true
+		}
+	}
+	if !noTotal {
+		response.Total = total
+	}
+
+	return response, nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import "p3-graded-challenge-1-ziancarlos/apperrors"
+
+var (
+	ErrInvalidProductID  = apperrors.InvalidArgument("invalid_product_id", "invalid product ID")
+	ErrProductNotFound   = apperrors.NotFound("product_not_found", "product not found")
+	ErrProductNotDeleted = apperrors.Conflict("product_not_deleted", "product is not deleted")
+	ErrProductInUse      = apperrors.Conflict("product_in_use", "product is referenced by transactions or orders; use force with a reason to archive it")
+	ErrPriceMismatch     = apperrors.Conflict("price_mismatch", "price does not match the catalog price")
+	ErrOutOfStock        = apperrors.Conflict("out_of_stock", "not enough stock")
+
+	ErrInvalidReservationID = apperrors.InvalidArgument("invalid_reservation_id", "invalid reservation ID")
+	ErrReservationNotFound  = apperrors.NotFound("reservation_not_found", "reservation not found")
+	ErrReservationNotActive = apperrors.Conflict("reservation_not_active", "reservation is no longer active")
+	ErrReservationMismatch  = apperrors.Conflict("reservation_mismatch", "reservation does not match the transaction")
+	ErrReservationLimit     = apperrors.Conflict("reservation_limit_reached", "too many units of this product are already reserved")
+
+	ErrInvalidTransactionID     = apperrors.InvalidArgument("invalid_transaction_id", "invalid transaction ID")
+	ErrTransactionNotFound      = apperrors.NotFound("transaction_not_found", "transaction not found")
+	ErrTransactionNotDeleted    = apperrors.Conflict("transaction_not_deleted", "transaction is not deleted")
+	ErrTransactionPending       = apperrors.Conflict("transaction_pending", "transaction is still pending; cancel it before deleting it")
+	ErrTransactionNotRefundable = apperrors.Conflict("transaction_not_refundable", "transaction cannot be refunded")
+	ErrRefundExceedsTransaction = apperrors.Unprocessable("refund_exceeds_transaction", "refund exceeds the amount left to refund")
+
+	ErrInvalidTransactionTransition = apperrors.Conflict("invalid_transaction_transition", "transaction cannot move to the requested status")
+	ErrTransactionFieldLocked       = apperrors.Conflict("transaction_field_locked", "field cannot be changed in the transaction's current status")
+	ErrNoFieldsToUpdate             = apperrors.InvalidArgument("no_fields_to_update", "no fields to update")
+
+	ErrInvalidOrderID = apperrors.InvalidArgument("invalid_order_id", "invalid order ID")
+	ErrOrderNotFound  = apperrors.NotFound("order_not_found", "order not found")
+
+	ErrInvalidCartID    = apperrors.InvalidArgument("invalid_cart_id", "invalid cart ID")
+	ErrCartNotFound     = apperrors.NotFound("cart_not_found", "cart not found")
+	ErrCartNotActive    = apperrors.Conflict("cart_not_active", "cart has already been checked out")
+	ErrCartItemNotFound = apperrors.NotFound("cart_item_not_found", "product is not in the cart")
+	ErrCartFull         = apperrors.Conflict("cart_full", "cart is full")
+	ErrCartEmpty        = apperrors.Conflict("cart_empty", "cart is empty")
+	ErrQuantityTooLarge = apperrors.InvalidArgument("quantity_too_large", "quantity is too large")
+
+	ErrInvalidCredentials = apperrors.Unauthenticated("invalid_credentials", "invalid username or password")
+	ErrUsernameTaken      = apperrors.Conflict("username_taken", "username is already taken")
+	ErrUnknownRole        = apperrors.InvalidArgument("unknown_role", "role is not defined by the access policy")
+
+	// ErrPaymentServiceUnavailable wraps failures to reach the payment service
+	ErrPaymentServiceUnavailable = apperrors.UpstreamUnavailable("payment_service_unavailable", "payment service unavailable")
+)
+
+// ErrInvalidQuery is wrapped by list operations when the query parameters
+// cannot be turned into a repository filter.
+var ErrInvalidQuery = apperrors.InvalidArgument("invalid_query", "invalid query")
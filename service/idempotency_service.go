@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"p3-graded-challenge-1-ziancarlos/apperrors"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/repository"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyReused    = apperrors.Conflict("idempotency_key_reused", "idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProcess = apperrors.Conflict("idempotency_key_in_process", "a request with this idempotency key is still being processed")
+)
+
+type IdempotencyService interface {
+	// Begin claims key for the request. It returns the stored record when the
+	// same request was already completed, or nil when the caller should proceed.
+	// A claim whose lock has run out is taken over by the same request.
+	Begin(ctx context.Context, key, method, path string, body []byte) (*models.IdempotencyRecord, error)
+	Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error
+	Release(ctx context.Context, key string) error
+}
+
+type idempotencyService struct {
+	repo repository.IdempotencyRepository
+	cfg  config.IdempotencyConfig
+}
+
+func NewIdempotencyService(repo repository.IdempotencyRepository, cfg config.IdempotencyConfig) IdempotencyService {
+	return &idempotencyService{
+		repo: repo,
+		cfg:  cfg,
+	}
+}
+
+func (s *idempotencyService) Begin(ctx context.Context, key, method, path string, body []byte) (*models.IdempotencyRecord, error) {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+
+	now := time.Now()
+	record := &models.IdempotencyRecord{
+		Key:         key,
+		RequestHash: hex.EncodeToString(hash.Sum(nil)),
+		LockedUntil: now.Add(s.cfg.LockTimeout),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.cfg.Retention),
+	}
+
+	existing, err := s.repo.Reserve(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, nil
+	}
+
+	if existing.RequestHash != record.RequestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !existing.Completed {
+		return nil, ErrIdempotencyKeyInProcess
+	}
+
+	return existing, nil
+}
+
+func (s *idempotencyService) Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	return s.repo.Complete(ctx, key, statusCode, contentType, body)
+}
+
+func (s *idempotencyService) Release(ctx context.Context, key string) error {
+	return s.repo.Release(ctx, key)
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"log"
+	"p3-graded-challenge-1-ziancarlos/auth"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/repository"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Inventory changes product stock, keeps the adjustment log and moves units
+// in and out of reservations. It is shared by manual adjustments, checkout,
+// the payment worker and the reservation sweeper.
+type Inventory struct {
+	productRepo     repository.ProductRepository
+	adjustmentRepo  repository.StockAdjustmentRepository
+	reservationRepo repository.ReservationRepository
+	cfg             *config.Config
+}
+
+func NewInventory(productRepo repository.ProductRepository, adjustmentRepo repository.StockAdjustmentRepository, reservationRepo repository.ReservationRepository, cfg *config.Config) *Inventory {
+	return &Inventory{
+		productRepo:     productRepo,
+		adjustmentRepo:  adjustmentRepo,
+		reservationRepo: reservationRepo,
+		cfg:             cfg,
+	}
+}
+
+// stockOwner names the transaction or order a stock movement is made for.
+// Manual adjustments have neither.
+type stockOwner struct {
+	transactionID *primitive.ObjectID
+	orderID       *primitive.ObjectID
+}
+
+func transactionOwner(t *models.Transaction) stockOwner {
+	return stockOwner{transactionID: &t.ID}
+}
+
+func orderOwner(o *models.Order) stockOwner {
+	return stockOwner{orderID: &o.ID}
+}
+
+// adjust applies delta atomically and records why. The stock change is the
+// source of truth: a failure to write the log entry is logged, not returned.
+func (i *Inventory) adjust(ctx context.Context, productID primitive.ObjectID, delta int64, reason, note string, owner stockOwner) (*models.StockAdjustment, error) {
+	product, err := i.productRepo.AdjustStock(ctx, productID, delta, 0)
+	if err != nil {
+		return nil, stockError(err)
+	}
+
+	return i.record(ctx, product, delta, reason, note, owner), nil
+}
+
+func (i *Inventory) record(ctx context.Context, product *models.Product, delta int64, reason, note string, owner stockOwner) *models.StockAdjustment {
+	adjustment := &models.StockAdjustment{
+		ProductID:     product.ID,
+		Quantity:      delta,
+		Reason:        reason,
+		Note:          note,
+		TransactionID: owner.transactionID,
+		OrderID:       owner.orderID,
+		StockAfter:    product.Stock,
+	}
+	if err := i.adjustmentRepo.Create(ctx, adjustment); err != nil {
+		log.Printf("failed to record stock adjustment for product %s: %v", product.ID.Hex(), err)
+	}
+	return adjustment
+}
+
+func stockError(err error) error {
+	switch err {
+	case mongo.ErrNoDocuments:
+		return ErrProductNotFound
+	case repository.ErrInsufficientStock:
+		return ErrOutOfStock
+	}
+	return err
+}
+
+// reserve moves quantity units from the available stock into a new
+// reservation that expires after ttl, optionally already held by its owner.
+func (i *Inventory) reserve(ctx context.Context, productID primitive.ObjectID, quantity int64, ttl time.Duration, owner stockOwner) (*models.Reservation, error) {
+	if _, err := i.productRepo.AdjustStock(ctx, productID, -quantity, quantity); err != nil {
+		return nil, stockError(err)
+	}
+
+	reservation := &models.Reservation{
+		ProductID:     productID,
+		Quantity:      quantity,
+		TransactionID: owner.transactionID,
+		OrderID:       owner.orderID,
+		CreatedBy:     auth.Subject(ctx),
+		ExpiresAt:     time.Now().Add(ttl),
+	}
+	if err := i.reservationRepo.Create(ctx, reservation); err != nil {
+		if _, undoErr := i.productRepo.AdjustStock(context.WithoutCancel(ctx), productID, quantity, -quantity); undoErr != nil {
+			log.Printf("failed to return %d reserved units to product %s: %v", quantity, productID.Hex(), undoErr)
+		}
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// attach hands a reservation to a transaction, giving it a fresh TTL so the
+// payment has the full window to complete.
+func (i *Inventory) attach(ctx context.Context, reservationID, transactionID primitive.ObjectID) (*models.Reservation, error) {
+	reservation, err := i.reservationRepo.Attach(ctx, reservationID, transactionID, time.Now().Add(i.cfg.Reservation.TTL))
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrReservationNotActive
+	}
+	return reservation, err
+}
+
+// release returns the units of a reservation in status from to the available
+// stock. The status change claims the reservation, so units are returned once
+// even when the sweeper and a failing transaction race.
+func (i *Inventory) release(ctx context.Context, reservation *models.Reservation, from, to string) error {
+	// Once claimed the units must go back even if the caller gives up
+	ctx = context.WithoutCancel(ctx)
+	if err := i.reservationRepo.UpdateStatus(ctx, reservation.ID, from, to); err != nil {
+		return err
+	}
+
+	if _, err := i.productRepo.AdjustStock(ctx, reservation.ProductID, reservation.Quantity, -reservation.Quantity); err != nil {
+		// Hand the reservation back so the next attempt can return the units
+		if undoErr := i.reservationRepo.UpdateStatus(ctx, reservation.ID, to, from); undoErr != nil {
+			log.Printf("reservation %s is %s but its units were not returned: %v", reservation.ID.Hex(), to, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// convertReservation turns reserved units into a sale. If the reservation
+// ran out before the payment got this far, the units are taken from the
+// available stock again, failing with ErrOutOfStock when someone else has
+// bought them in the meantime.
+func (i *Inventory) convertReservation(ctx context.Context, reservationID primitive.ObjectID, owner stockOwner) error {
+	reservation, err := i.reservationRepo.FindByID(ctx, reservationID)
+	if err != nil {
+		return err
+	}
+
+	switch reservation.Status {
+	case models.ReservationStatusConverted:
+		return nil
+	case models.ReservationStatusActive:
+		if err := i.reservationRepo.UpdateStatus(ctx, reservation.ID, models.ReservationStatusActive, models.ReservationStatusConverted); err != nil {
+			if err == mongo.ErrNoDocuments {
+				// Expired or released under us; look again
+				return i.convertReservation(ctx, reservationID, owner)
+			}
+			return err
+		}
+		product, err := i.productRepo.AdjustStock(ctx, reservation.ProductID, 0, -reservation.Quantity)
+		if err != nil {
+			if undoErr := i.reservationRepo.UpdateStatus(context.WithoutCancel(ctx), reservation.ID, models.ReservationStatusConverted, models.ReservationStatusActive); undoErr != nil {
+				log.Printf("reservation %s is converted but its units are still reserved: %v", reservation.ID.Hex(), err)
+			}
+			return err
+		}
+		i.record(ctx, product, -reservation.Quantity, models.StockReasonSale, "", owner)
+		return nil
+	default:
+		if _, err := i.adjust(ctx, reservation.ProductID, -reservation.Quantity, models.StockReasonSale, "reservation "+reservation.Status+" before payment", owner); err != nil {
+			return err
+		}
+		if err := i.reservationRepo.UpdateStatus(ctx, reservation.ID, reservation.Status, models.ReservationStatusConverted); err != nil {
+			log.Printf("failed to mark reservation %s converted: %v", reservation.ID.Hex(), err)
+		}
+		return nil
+	}
+}
+
+// convertOrder turns the reservations of every line of the order into sales.
+func (i *Inventory) convertOrder(ctx context.Context, order *models.Order) error {
+	for _, item := range order.Items {
+		if item.ReservationID == nil {
+			continue
+		}
+		if err := i.convertReservation(ctx, *item.ReservationID, orderOwner(order)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseTransaction gives back the units of a transaction that will not be
+// paid, whether they are still reserved or were already sold.
+func (i *Inventory) releaseTransaction(ctx context.Context, transaction *models.Transaction) {
+	// Cleanup runs to the end even when the request that failed is gone
+	ctx = context.WithoutCancel(ctx)
+	if transaction.ReservationID == nil {
+		i.restoreSale(ctx, transaction)
+		return
+	}
+	if err := i.releaseReservation(ctx, *transaction.ReservationID, transactionOwner(transaction)); err != nil {
+		log.Printf("failed to release stock for transaction %s: %v", transaction.ID.Hex(), err)
+	}
+}
+
+// releaseOrder gives back the units of every line of an order that will not
+// be paid.
+func (i *Inventory) releaseOrder(ctx context.Context, order *models.Order) {
+	ctx = context.WithoutCancel(ctx)
+	for _, item := range order.Items {
+		if item.ReservationID == nil {
+			continue
+		}
+		if err := i.releaseReservation(ctx, *item.ReservationID, orderOwner(order)); err != nil {
+			log.Printf("failed to release stock for order %s: %v", order.ID.Hex(), err)
+		}
+	}
+}
+
+// releaseReservation returns the units of a reservation whose owner will not
+// be paid, whether they are still reserved or were already sold.
+func (i *Inventory) releaseReservation(ctx context.Context, reservationID primitive.ObjectID, owner stockOwner) error {
+	reservation, err := i.reservationRepo.FindByID(ctx, reservationID)
+	if err != nil {
+		return err
+	}
+
+	switch reservation.Status {
+	case models.ReservationStatusActive:
+		err = i.release(ctx, reservation, models.ReservationStatusActive, models.ReservationStatusReleased)
+	case models.ReservationStatusConverted:
+		err = i.reservationRepo.UpdateStatus(ctx, reservation.ID, models.ReservationStatusConverted, models.ReservationStatusReleased)
+		if err == nil {
+			_, err = i.adjust(ctx, reservation.ProductID, reservation.Quantity, models.StockReasonSaleReversal, "", owner)
+		}
+	}
+	if err == mongo.ErrNoDocuments {
+		// Someone else moved the reservation on first
+		return nil
+	}
+	return err
+}
+
+// restoreSale puts back the units taken directly by a transaction made before
+// reservations. Transactions created before stock tracking have no quantity
+// and took nothing.
+func (i *Inventory) restoreSale(ctx context.Context, transaction *models.Transaction) {
+	if transaction.Quantity <= 0 {
+		return
+	}
+	if _, err := i.adjust(ctx, transaction.ProductID, transaction.Quantity, models.StockReasonSaleReversal, "", transactionOwner(transaction)); err != nil {
+		log.Printf("failed to restore stock for transaction %s: %v", transaction.ID.Hex(), err)
+	}
+}
+
+// expire returns the units of every reservation whose time is up and reports
+// how many were released.
+func (i *Inventory) expire(ctx context.Context, limit int64) (int, error) {
+	reservations, err := i.reservationRepo.FindExpired(ctx, time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for idx := range reservations {
+		err := i.release(ctx, &reservations[idx], models.ReservationStatusActive, models.ReservationStatusExpired)
+		if err == nil {
+			released++
+		} else if err != mongo.ErrNoDocuments {
+			log.Printf("failed to expire reservation %s: %v", reservations[idx].ID.Hex(), err)
+		}
+	}
+
+	return released, nil
+}
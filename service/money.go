@@ -0,0 +1,44 @@
+package service
+
+import (
+	"fmt"
+	"p3-graded-challenge-1-ziancarlos/models"
+)
+
+// parseMoneyRange parses the min/max query parameters of list endpoints in
+// currency (DefaultCurrency when empty).
+func parseMoneyRange(minValue, maxValue, currency string) (models.Money, models.Money, error) {
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+
+	var min, max models.Money
+	var err error
+	if minValue != "" {
+		if min, err = models.ParseMoney(minValue, currency); err != nil {
+			return min, max, fmt.Errorf("%w: invalid minimum: %v", ErrInvalidQuery, err)
+		}
+	}
+	if maxValue != "" {
+		if max, err = models.ParseMoney(maxValue, currency); err != nil {
+			return min, max, fmt.Errorf("%w: invalid maximum: %v", ErrInvalidQuery, err)
+		}
+	}
+	if min.Amount < 0 || max.Amount < 0 {
+		return min, max, fmt.Errorf("%w: amounts must not be negative", ErrInvalidQuery)
+	}
+	if !max.IsZero() && min.Amount > max.Amount {
+		return min, max, fmt.Errorf("%w: minimum must not be greater than maximum", ErrInvalidQuery)
+	}
+
+	return min, max, nil
+}
+
+// zeroIfUnset gives an unset amount (e.g. a refunded total that was never
+// written) the currency of the amount it is measured against.
+func zeroIfUnset(m models.Money, currency string) models.Money {
+	if m.Currency == "" && m.IsZero() {
+		return models.NewMoney(0, currency)
+	}
+	return m
+}
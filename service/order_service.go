@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"p3-graded-challenge-1-ziancarlos/auth"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type OrderService interface {
+	CreateOrder(ctx context.Context, req *models.OrderRequest) (*models.OrderResponse, error)
+	GetAllOrders(ctx context.Context, query *models.OrderQuery) ([]models.OrderResponse, *models.PageMeta, error)
+	GetOrderByID(ctx context.Context, id string) (*models.OrderResponse, error)
+}
+
+type orderService struct {
+	repo        repository.OrderRepository
+	productRepo repository.ProductRepository
+	outboxRepo  repository.OutboxRepository
+	inventory   *Inventory
+	policy      *auth.Policy
+	cfg         *config.Config
+}
+
+func NewOrderService(repo repository.OrderRepository, productRepo repository.ProductRepository, outboxRepo repository.OutboxRepository, inventory *Inventory, policy *auth.Policy, cfg *config.Config) OrderService {
+	return &orderService{
+		repo:        repo,
+		productRepo: productRepo,
+		outboxRepo:  outboxRepo,
+		inventory:   inventory,
+		policy:      policy,
+		cfg:         cfg,
+	}
+}
+
+// CreateOrder prices every line from the catalog, reserves the units and
+// schedules one payment for the order total. Like a transaction, the order
+// stays pending until the payment worker settles it.
+func (s *orderService) CreateOrder(ctx context.Context, req *models.OrderRequest) (*models.OrderResponse, error) {
+	order := &models.Order{
+		ID:            primitive.NewObjectID(),
+		PaymentMethod: req.PaymentMethod,
+		CreatedBy:     auth.Subject(ctx),
+	}
+
+	for idx := range req.Items {
+		item, err := s.reserveItem(ctx, order, &req.Items[idx])
+		if err != nil {
+			// Hand back what the earlier lines reserved
+			s.inventory.releaseOrder(ctx, order)
+			return nil, fmt.Errorf("item %d: %w", idx, err)
+		}
+		order.Items = append(order.Items, *item)
+	}
+
+	// Every line is in the same currency, so the sum can only overflow
+	order.Total = models.NewMoney(0, order.Items[0].UnitPrice.Currency)
+	for _, item := range order.Items {
+		total, err := order.Total.Add(item.LineTotal)
+		if err != nil {
+			s.inventory.releaseOrder(ctx, order)
+			return nil, err
+		}
+		order.Total = total
+	}
+
+	if err := s.repo.Create(ctx, order); err != nil {
+		s.inventory.releaseOrder(ctx, order)
+		return nil, err
+	}
+
+	// The payment itself is made by the payment worker from this outbox entry
+	entry := &models.OutboxEntry{
+		Type:    models.OutboxTypePaymentCharge,
+		OrderID: order.ID,
+		Amount:  order.Total,
+	}
+	if err := s.outboxRepo.Create(ctx, entry); err != nil {
+		reason := bson.M{"failure_reason": "failed to schedule payment"}
+		if markErr := s.repo.UpdateStatus(context.WithoutCancel(ctx), order.ID, models.OrderStatusPending, models.OrderStatusFailed, reason); markErr != nil {
+			log.Printf("failed to mark order %s failed: %v", order.ID.Hex(), markErr)
+		}
+		s.inventory.releaseOrder(ctx, order)
+		return nil, fmt.Errorf("failed to schedule payment: %w", err)
+	}
+
+	return toOrderResponse(order), nil
+}
+
+// reserveItem prices one line from the catalog and reserves its units for the order.
+func (s *orderService) reserveItem(ctx context.Context, order *models.Order, req *models.OrderItemRequest) (*models.OrderItem, error) {
+	productID, err := primitive.ObjectIDFromHex(req.ProductID)
+	if err != nil {
+		return nil, ErrInvalidProductID
+	}
+
+	product, err := s.productRepo.FindByID(ctx, productID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	if !req.Price.IsZero() && req.Price != product.Price {
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrPriceMismatch, product.Price, req.Price)
+	}
+
+	quantity := req.Quantity
+	if quantity == 0 {
+		quantity = 1
+	}
+	if len(order.Items) > 0 && product.Price.Currency != order.Items[0].UnitPrice.Currency {
+		return nil, fmt.Errorf("%w: order is in %s, product is priced in %s", models.ErrCurrencyMismatch, order.Items[0].UnitPrice.Currency, product.Price.Currency)
+	}
+	lineTotal, err := product.Price.Mul(quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	reservation, err := s.inventory.reserve(ctx, productID, quantity, s.cfg.Reservation.TTL, orderOwner(order))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OrderItem{
+		ProductID:     productID,
+		Name:          product.Name,
+		Quantity:      quantity,
+		UnitPrice:     product.Price,
+		LineTotal:     lineTotal,
+		ReservationID: &reservation.ID,
+	}, nil
+}
+
+func (s *orderService) GetAllOrders(ctx context.Context, query *models.OrderQuery) ([]models.OrderResponse, *models.PageMeta, error) {
+	filter, err := buildOrderFilter(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter.CreatedBy = ownerScope(ctx, s.policy, auth.PermOrdersReadAll)
+
+	orders, err := s.repo.FindAll(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	response := []models.OrderResponse{}
+	for i := range orders {
+		response = append(response, *toOrderResponse(&orders[i]))
+	}
+
+	meta := &models.PageMeta{Limit: filter.Limit}
+	if int64(len(orders)) == filter.Limit {
+		last := orders[len(orders)-1]
+		meta.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return response, meta, nil
+}
+
+func buildOrderFilter(query *models.OrderQuery) (*models.OrderFilter, error) {
+	filter := &models.OrderFilter{
+		Status: query.Status,
+		Limit:  query.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = models.DefaultPageLimit
+	}
+
+	var err error
+	if query.From != "" {
+		if filter.From, err = parseQueryTime(query.From); err != nil {
+			return nil, fmt.Errorf("%w: invalid from date", ErrInvalidQuery)
+		}
+	}
+	if query.To != "" {
+		if filter.To, err = parseQueryTime(query.To); err != nil {
+			return nil, fmt.Errorf("%w: invalid to date", ErrInvalidQuery)
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+
+	if query.Cursor != "" {
+		filter.CursorDate, filter.CursorID, err = decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+		}
+	}
+
+	return filter, nil
+}
+
+func (s *orderService) GetOrderByID(ctx context.Context, id string) (*models.OrderResponse, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidOrderID
+	}
+
+	order, err := s.repo.FindByID(ctx, objectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	if !ownedBy(ctx, s.policy, auth.PermOrdersReadAll, order.CreatedBy) {
+		return nil, ErrOrderNotFound
+	}
+
+	return toOrderResponse(order), nil
+}
+
+func toOrderResponse(o *models.Order) *models.OrderResponse {
+	items := make([]models.OrderItemResponse, 0, len(o.Items))
+	for _, item := range o.Items {
+		items = append(items, models.OrderItemResponse{
+			ProductID: item.ProductID.Hex(),
+			Name:      item.Name,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			LineTotal: item.LineTotal,
+		})
+	}
+
+	return &models.OrderResponse{
+		ID:            o.ID.Hex(),
+		Items:         items,
+		Total:         o.Total,
+		PaymentMethod: o.PaymentMethod,
+		PaymentID:     o.PaymentID,
+		Status:        o.Status,
+		FailureReason: o.FailureReason,
+		CreatedBy:     o.CreatedBy,
+		CreatedAt:     o.CreatedAt,
+		UpdatedAt:     o.UpdatedAt,
+	}
+}
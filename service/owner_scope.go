@@ -0,0 +1,23 @@
+package service
+
+import (
+	"context"
+	"p3-graded-challenge-1-ziancarlos/auth"
+)
+
+// ownerScope returns the subject whose records the caller is limited to, or
+// "" when the caller holds readAll and may see everyone's.
+func ownerScope(ctx context.Context, policy *auth.Policy, readAll auth.Permission) string {
+	if !policy.Denies(ctx, readAll) {
+		return ""
+	}
+	return auth.Subject(ctx)
+}
+
+// ownedBy reports whether the caller may see a record created by createdBy.
+// Others' records are reported as not found rather than forbidden so their
+// IDs cannot be probed.
+func ownedBy(ctx context.Context, policy *auth.Policy, readAll auth.Permission, createdBy string) bool {
+	owner := ownerScope(ctx, policy, readAll)
+	return owner == "" || createdBy == owner
+}
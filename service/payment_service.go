@@ -1,40 +1,292 @@
 package service
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"p3-graded-challenge-1-ziancarlos/apperrors"
 	"p3-graded-challenge-1-ziancarlos/models"
 	"p3-graded-challenge-1-ziancarlos/repository"
+	"time"
 
-	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+var (
+	ErrInvalidPaymentID         = apperrors.InvalidArgument("invalid_payment_id", "invalid payment ID")
+	ErrPaymentNotFound          = apperrors.NotFound("payment_not_found", "payment not found")
+	ErrInvalidPaymentTransition = apperrors.Conflict("invalid_payment_transition", "payment cannot move to the requested status")
+	ErrRefundExceedsPayment     = apperrors.Unprocessable("refund_exceeds_payment", "refund exceeds the amount left to refund")
+)
+
+var paymentTransitions = map[string][]string{
+	models.PaymentStatusAuthorized:        {models.PaymentStatusCaptured, models.PaymentStatusVoided},
+	models.PaymentStatusCaptured:          {models.PaymentStatusPartiallyRefunded, models.PaymentStatusRefunded},
+	models.PaymentStatusPartiallyRefunded: {models.PaymentStatusPartiallyRefunded, models.PaymentStatusRefunded},
+}
+
+func canTransitionPayment(from, to string) bool {
+	for _, allowed := range paymentTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
 type PaymentService interface {
-	CreatePayment(req *models.PaymentRequest) (*models.PaymentResponse, error)
+	CreatePayment(ctx context.Context, req *models.PaymentRequest) (*models.PaymentResponse, error)
+	GetAllPayments(ctx context.Context, query *models.PaymentQuery) ([]models.PaymentResponse, *models.PageMeta, error)
+	GetPaymentByID(ctx context.Context, id string) (*models.PaymentResponse, error)
+	CapturePayment(ctx context.Context, id string) (*models.PaymentResponse, error)
+	VoidPayment(ctx context.Context, id string) (*models.PaymentResponse, error)
+	RefundPayment(ctx context.Context, id string, req *models.RefundRequest) (*models.RefundResponse, error)
+	GetRefunds(ctx context.Context, id string) ([]models.RefundResponse, error)
 }
 
 type paymentService struct {
-	repo      repository.PaymentRepository
-	validator *validator.Validate
+	repo       repository.PaymentRepository
+	refundRepo repository.RefundRepository
 }
 
-func NewPaymentService(repo repository.PaymentRepository) PaymentService {
+func NewPaymentService(repo repository.PaymentRepository, refundRepo repository.RefundRepository) PaymentService {
 	return &paymentService{
-		repo:      repo,
-		validator: validator.New(),
+		repo:       repo,
+		refundRepo: refundRepo,
 	}
 }
 
-func (s *paymentService) CreatePayment(req *models.PaymentRequest) (*models.PaymentResponse, error) {
-	if err := s.validator.Struct(req); err != nil {
+func (s *paymentService) CreatePayment(ctx context.Context, req *models.PaymentRequest) (*models.PaymentResponse, error) {
+	payment := &models.Payment{
+		Amount:         req.Amount,
+		RefundedAmount: models.NewMoney(0, req.Amount.Currency),
+		Status:         models.PaymentStatusAuthorized,
+		TransactionID:  req.TransactionID,
+		OrderID:        req.OrderID,
+	}
+	if err := s.repo.Create(ctx, payment); err != nil {
 		return nil, err
 	}
-	payment := &models.Payment{
-		Amount: req.Amount,
+	return toPaymentResponse(payment), nil
+}
+
+func (s *paymentService) GetAllPayments(ctx context.Context, query *models.PaymentQuery) ([]models.PaymentResponse, *models.PageMeta, error) {
+	filter, err := buildPaymentFilter(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payments, total, err := s.repo.FindAll(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	response := []models.PaymentResponse{}
+	for i := range payments {
+		response = append(response, *toPaymentResponse(&payments[i]))
+	}
+
+	meta := &models.PageMeta{
+		Page:  max(query.Page, 1),
+		Limit: filter.Limit,
+		Total: &total,
+	}
+
+	return response, meta, nil
+}
+
+func buildPaymentFilter(query *models.PaymentQuery) (*models.PaymentFilter, error) {
+	minAmount, maxAmount, err := parseMoneyRange(query.MinAmount, query.MaxAmount, query.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &models.PaymentFilter{
+		MinAmount:     minAmount,
+		MaxAmount:     maxAmount,
+		Status:        query.Status,
+		TransactionID: query.TransactionID,
+		OrderID:       query.OrderID,
+		Limit:         query.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = models.DefaultPageLimit
+	}
+	if query.Page > 1 {
+		filter.Skip = (query.Page - 1) * filter.Limit
+	}
+
+	if query.From != "" {
+		if filter.From, err = parseQueryTime(query.From); err != nil {
+			return nil, fmt.Errorf("%w: invalid from date", ErrInvalidQuery)
+		}
+	}
+	if query.To != "" {
+		if filter.To, err = parseQueryTime(query.To); err != nil {
+			return nil, fmt.Errorf("%w: invalid to date", ErrInvalidQuery)
+		}
+	}
+
+	return filter, nil
+}
+
+func (s *paymentService) GetPaymentByID(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	payment, err := s.findPayment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return toPaymentResponse(payment), nil
+}
+
+// CapturePayment settles an authorized payment. Capturing twice is a no-op.
+func (s *paymentService) CapturePayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	return s.transition(ctx, id, models.PaymentStatusCaptured)
+}
+
+// VoidPayment cancels an authorized payment. Voiding twice is a no-op so that
+// compensation steps can be retried safely.
+func (s *paymentService) VoidPayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	return s.transition(ctx, id, models.PaymentStatusVoided)
+}
+
+func (s *paymentService) transition(ctx context.Context, id string, to string) (*models.PaymentResponse, error) {
+	payment, err := s.findPayment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status == to {
+		return toPaymentResponse(payment), nil
 	}
-	if err := s.repo.Create(payment); err != nil {
+	if !canTransitionPayment(payment.Status, to) {
+		return nil, fmt.Errorf("%w: %s payment cannot become %s", ErrInvalidPaymentTransition, payment.Status, to)
+	}
+	if err := s.repo.UpdateStatus(ctx, payment.ID, payment.Status, to); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("%w: payment was modified concurrently", ErrInvalidPaymentTransition)
+		}
+		return nil, err
+	}
+	payment.Status = to
+	payment.UpdatedAt = time.Now()
+	return toPaymentResponse(payment), nil
+}
+
+// RefundPayment returns part or all of a captured payment. Several partial
+// refunds are allowed as long as their total stays within the payment amount.
+func (s *paymentService) RefundPayment(ctx context.Context, id string, req *models.RefundRequest) (*models.RefundResponse, error) {
+	payment, err := s.findPayment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	alreadyRefunded := zeroIfUnset(payment.RefundedAmount, payment.Amount.Currency)
+	remaining, err := payment.Amount.Sub(alreadyRefunded)
+	if err != nil {
+		return nil, err
+	}
+	amount := req.Amount
+	if amount.IsZero() {
+		amount = remaining
+	}
+	if exceeds, err := amount.Cmp(remaining); err != nil {
+		return nil, err
+	} else if exceeds > 0 {
+		return nil, fmt.Errorf("%w: %s left to refund", ErrRefundExceedsPayment, remaining)
+	}
+
+	refunded, err := alreadyRefunded.Add(amount)
+	if err != nil {
+		return nil, err
+	}
+	to := models.PaymentStatusPartiallyRefunded
+	if refunded.Amount >= payment.Amount.Amount {
+		to = models.PaymentStatusRefunded
+	}
+	if !canTransitionPayment(payment.Status, to) {
+		return nil, fmt.Errorf("%w: %s payment cannot be refunded", ErrInvalidPaymentTransition, payment.Status)
+	}
+
+	// Record the refund first so that money is never returned without a record of it
+	refund := &models.Refund{
+		PaymentID: payment.ID,
+		Amount:    amount,
+		Reason:    req.Reason,
+	}
+	if err := s.refundRepo.Create(ctx, refund); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.ApplyRefund(ctx, payment.ID, payment.Status, alreadyRefunded, to, refunded); err != nil {
+		if deleteErr := s.refundRepo.Delete(ctx, refund.ID); deleteErr != nil {
+			log.Printf("failed to remove unapplied refund %s: %v", refund.ID.Hex(), deleteErr)
+		}
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("%w: payment was modified concurrently", ErrInvalidPaymentTransition)
+		}
+		return nil, err
+	}
+	payment.Status = to
+	payment.RefundedAmount = refunded
+	payment.UpdatedAt = time.Now()
+
+	response := toRefundResponse(refund)
+	response.Payment = toPaymentResponse(payment)
+	return response, nil
+}
+
+func (s *paymentService) GetRefunds(ctx context.Context, id string) ([]models.RefundResponse, error) {
+	payment, err := s.findPayment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	refunds, err := s.refundRepo.FindByPaymentID(ctx, payment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := []models.RefundResponse{}
+	for i := range refunds {
+		response = append(response, *toRefundResponse(&refunds[i]))
+	}
+	return response, nil
+}
+
+func (s *paymentService) findPayment(ctx context.Context, id string) (*models.Payment, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidPaymentID
+	}
+	payment, err := s.repo.FindByID(ctx, objectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrPaymentNotFound
+		}
 		return nil, err
 	}
+	return payment, nil
+}
+
+func toPaymentResponse(payment *models.Payment) *models.PaymentResponse {
 	return &models.PaymentResponse{
-		ID:     payment.ID.Hex(),
-		Amount: payment.Amount,
-	}, nil
+		ID:             payment.ID.Hex(),
+		Amount:         payment.Amount,
+		Status:         payment.Status,
+		RefundedAmount: zeroIfUnset(payment.RefundedAmount, payment.Amount.Currency),
+		TransactionID:  payment.TransactionID,
+		OrderID:        payment.OrderID,
+		CreatedAt:      payment.CreatedAt,
+		UpdatedAt:      payment.UpdatedAt,
+	}
+}
+
+func toRefundResponse(refund *models.Refund) *models.RefundResponse {
+	return &models.RefundResponse{
+		ID:        refund.ID.Hex(),
+		PaymentID: refund.PaymentID.Hex(),
+		Amount:    refund.Amount,
+		Reason:    refund.Reason,
+		CreatedAt: refund.CreatedAt,
+	}
 }
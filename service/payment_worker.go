@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/paymentclient"
+	"p3-graded-challenge-1-ziancarlos/repository"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const maxOutboxBackoff = 5 * time.Minute
+
+// permanentError marks a saga step failure that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// PaymentWorker drives the payment saga: it takes outbox entries written by
+// CreateTransaction and CreateOrder, authorizes and captures the payment and
+// settles the transaction or order, voiding or refunding the payment when a
+// later step fails. Every call carries an Idempotency-Key derived from the
+// transaction or order, so a retry after a timeout returns the payment that
+// was already made instead of charging twice. Short transient failures are
+// retried inside paymentClient; longer outages are retried here with the
+// outbox backoff.
+type PaymentWorker struct {
+	outboxRepo      repository.OutboxRepository
+	transactionRepo repository.TransactionRepository
+	orderRepo       repository.OrderRepository
+	inventory       *Inventory
+	paymentClient   paymentclient.Client
+	cfg             *config.Config
+}
+
+func NewPaymentWorker(outboxRepo repository.OutboxRepository, transactionRepo repository.TransactionRepository, orderRepo repository.OrderRepository, inventory *Inventory, paymentClient paymentclient.Client, cfg *config.Config) *PaymentWorker {
+	return &PaymentWorker{
+		outboxRepo:      outboxRepo,
+		transactionRepo: transactionRepo,
+		orderRepo:       orderRepo,
+		inventory:       inventory,
+		paymentClient:   paymentClient,
+		cfg:             cfg,
+	}
+}
+
+// Run polls the outbox until ctx is cancelled.
+func (w *PaymentWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Outbox.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		w.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *PaymentWorker) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		entry, err := w.outboxRepo.ClaimNext(ctx, w.cfg.Outbox.LockTimeout)
+		if err != nil {
+			if err != mongo.ErrNoDocuments {
+				log.Printf("outbox: failed to claim entry: %v", err)
+			}
+			return
+		}
+
+		// Record the outcome even when shutdown starts mid-step, so the entry
+		// is not left locked until the lock times out
+		bookkeeping := context.WithoutCancel(ctx)
+		if err := w.process(ctx, entry); err != nil {
+			w.handleFailure(bookkeeping, entry, err)
+			continue
+		}
+
+		if err := w.outboxRepo.MarkDone(bookkeeping, entry.ID); err != nil {
+			log.Printf("outbox: failed to mark entry %s done: %v", entry.ID.Hex(), err)
+		}
+	}
+}
+
+func (w *PaymentWorker) process(ctx context.Context, entry *models.OutboxEntry) error {
+	switch entry.Type {
+	case models.OutboxTypePaymentCharge:
+		return w.charge(ctx, entry)
+	case models.OutboxTypePaymentVoid:
+		return w.void(ctx, entry)
+	case models.OutboxTypePaymentRefund:
+		return w.refund(ctx, entry)
+	default:
+		return &permanentError{fmt.Errorf("unknown outbox entry type %q", entry.Type)}
+	}
+}
+
+// charge authorizes the payment, remembers it on the transaction or order,
+// turns the reserved units into sales, captures the payment and finally
+// confirms the target as paid. Each step is safe to repeat when the entry is
+// retried.
+func (w *PaymentWorker) charge(ctx context.Context, entry *models.OutboxEntry) error {
+	target := w.chargeTarget(entry)
+	awaiting, paymentID, err := target.load(ctx)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			// Only settled transactions can be deleted; nothing left to charge
+			return nil
+		}
+		return err
+	}
+	if !awaiting {
+		return nil
+	}
+
+	key := target.key()
+	if paymentID == "" {
+		payment, err := w.paymentClient.CreatePayment(ctx, target.paymentRequest(entry.Amount), "authorize-"+key)
+		if err != nil {
+			return paymentError(err)
+		}
+		paymentID = payment.ID
+
+		err = target.setPaymentID(ctx, paymentID)
+		if err == mongo.ErrNoDocuments {
+			// The target went away while we were authorizing: release the hold
+			return w.compensate(ctx, models.OutboxTypePaymentVoid, entry, paymentID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Secure the units before taking the money so a sold-out or deleted
+	// product only costs the buyer an authorization hold
+	if err := target.secureStock(ctx); err != nil {
+		if errors.Is(err, ErrOutOfStock) || errors.Is(err, ErrProductNotFound) {
+			return &permanentError{err}
+		}
+		return err
+	}
+
+	if _, err := w.paymentClient.CapturePayment(ctx, paymentID, "capture-"+key); err != nil {
+		return paymentError(err)
+	}
+
+	err = target.markPaid(ctx)
+	if err == mongo.ErrNoDocuments {
+		// The money is taken but the target can no longer be confirmed
+		return w.compensate(ctx, models.OutboxTypePaymentRefund, entry, paymentID)
+	}
+	return err
+}
+
+func (w *PaymentWorker) chargeTarget(entry *models.OutboxEntry) chargeTarget {
+	if !entry.OrderID.IsZero() {
+		return &orderCharge{w: w, entry: entry}
+	}
+	return &transactionCharge{w: w, entry: entry}
+}
+
+func (w *PaymentWorker) compensate(ctx context.Context, entryType string, entry *models.OutboxEntry, paymentID string) error {
+	return w.outboxRepo.Create(ctx, &models.OutboxEntry{
+		Type:          entryType,
+		TransactionID: entry.TransactionID,
+		OrderID:       entry.OrderID,
+		PaymentID:     paymentID,
+		Amount:        entry.Amount,
+	})
+}
+
+func (w *PaymentWorker) void(ctx context.Context, entry *models.OutboxEntry) error {
+	if _, err := w.paymentClient.VoidPayment(ctx, entry.PaymentID, "void-"+entry.PaymentID); err != nil {
+		var statusErr *paymentclient.StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict {
+			// The payment was captured after all, so the money has to go back
+			captured, lookupErr := w.captured(ctx, entry.PaymentID)
+			if lookupErr != nil {
+				return paymentError(lookupErr)
+			}
+			if captured {
+				return w.refund(ctx, entry)
+			}
+		}
+		return paymentError(err)
+	}
+	return nil
+}
+
+// captured reports whether the payment has been captured, and so can only be
+// undone by a refund.
+func (w *PaymentWorker) captured(ctx context.Context, paymentID string) (bool, error) {
+	payment, err := w.paymentClient.GetPayment(ctx, paymentID)
+	if err != nil {
+		return false, err
+	}
+	return payment.Status == models.PaymentStatusCaptured, nil
+}
+
+func (w *PaymentWorker) refund(ctx context.Context, entry *models.OutboxEntry) error {
+	req := &models.RefundRequest{
+		Amount: entry.Amount,
+		Reason: "transaction could not be confirmed",
+	}
+	if _, err := w.paymentClient.RefundPayment(ctx, entry.PaymentID, req, "refund-"+entry.ID.Hex()); err != nil {
+		return paymentError(err)
+	}
+	return nil
+}
+
+// paymentError marks definite rejections from the payment service as permanent.
+func paymentError(err error) error {
+	if paymentclient.IsRetryable(err) {
+		return err
+	}
+	return &permanentError{err}
+}
+
+func (w *PaymentWorker) handleFailure(ctx context.Context, entry *models.OutboxEntry, stepErr error) {
+	var permanent *permanentError
+	if !errors.As(stepErr, &permanent) && entry.Attempts < w.cfg.Outbox.MaxAttempts {
+		backoff := time.Duration(1<<min(entry.Attempts, 16)) * time.Second
+		if backoff > maxOutboxBackoff {
+			backoff = maxOutboxBackoff
+		}
+		if err := w.outboxRepo.Reschedule(ctx, entry.ID, time.Now().Add(backoff), stepErr.Error()); err != nil {
+			log.Printf("outbox: failed to reschedule entry %s: %v", entry.ID.Hex(), err)
+		}
+		return
+	}
+
+	log.Printf("outbox: giving up on %s entry %s after %d attempts: %v", entry.Type, entry.ID.Hex(), entry.Attempts, stepErr)
+	if err := w.outboxRepo.MarkFailed(ctx, entry.ID, stepErr.Error()); err != nil {
+		log.Printf("outbox: failed to mark entry %s failed: %v", entry.ID.Hex(), err)
+	}
+
+	if entry.Type == models.OutboxTypePaymentCharge {
+		w.failCharge(ctx, entry, stepErr)
+	}
+}
+
+// failCharge marks the transaction or order failed, puts its units back in
+// stock and voids any authorization that was already made for it, or refunds
+// the payment if it was captured before a later step gave up.
+func (w *PaymentWorker) failCharge(ctx context.Context, entry *models.OutboxEntry, stepErr error) {
+	paymentID, err := w.chargeTarget(entry).fail(ctx, stepErr.Error())
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("outbox: failed to fail charge entry %s: %v", entry.ID.Hex(), err)
+		}
+		return
+	}
+	if paymentID == "" {
+		return
+	}
+
+	entryType := models.OutboxTypePaymentVoid
+	if captured, err := w.captured(ctx, paymentID); err != nil {
+		// The void entry checks again when it runs
+		log.Printf("outbox: failed to look up payment %s: %v", paymentID, err)
+	} else if captured {
+		entryType = models.OutboxTypePaymentRefund
+	}
+	if err := w.compensate(ctx, entryType, entry, paymentID); err != nil {
+		log.Printf("outbox: failed to schedule %s for payment %s: %v", entryType, paymentID, err)
+	}
+}
@@ -1,105 +1,175 @@
 package service
 
 import (
-	"errors"
+	"context"
+	"fmt"
+	"p3-graded-challenge-1-ziancarlos/auth"
 	"p3-graded-challenge-1-ziancarlos/models"
 	"p3-graded-challenge-1-ziancarlos/repository"
+	"strings"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type ProductService interface {
-	CreateProduct(req *models.ProductRequest) (*models.ProductResponse, error)
-	GetAllProducts() ([]models.ProductResponse, error)
-	GetProductByID(id string) (*models.ProductResponse, error)
-	UpdateProduct(id string, req *models.ProductRequest) error
-	DeleteProduct(id string) error
+	CreateProduct(ctx context.Context, req *models.ProductRequest) (*models.ProductResponse, error)
+	GetAllProducts(ctx context.Context, query *models.ProductQuery) ([]models.ProductResponse, *models.PageMeta, error)
+	GetProductByID(ctx context.Context, id string, includeDeleted bool) (*models.ProductResponse, error)
+	UpdateProduct(ctx context.Context, id string, req *models.ProductRequest) error
+	DeleteProduct(ctx context.Context, id string, query *models.ProductDeleteQuery) error
+	RestoreProduct(ctx context.Context, id string) (*models.ProductResponse, error)
+	AdjustStock(ctx context.Context, id string, req *models.StockAdjustmentRequest) (*models.StockAdjustment, error)
+	GetStockAdjustments(ctx context.Context, id string) ([]models.StockAdjustment, error)
 }
 
 type productService struct {
-	repo repository.ProductRepository
+	repo            repository.ProductRepository
+	transactionRepo repository.TransactionRepository
+	orderRepo       repository.OrderRepository
+	inventory       *Inventory
+	policy          *auth.Policy
 }
 
-func NewProductService(repo repository.ProductRepository) ProductService {
+func NewProductService(repo repository.ProductRepository, transactionRepo repository.TransactionRepository, orderRepo repository.OrderRepository, inventory *Inventory, policy *auth.Policy) ProductService {
 	return &productService{
-		repo: repo,
+		repo:            repo,
+		transactionRepo: transactionRepo,
+		orderRepo:       orderRepo,
+		inventory:       inventory,
+		policy:          policy,
 	}
 }
 
-func (s *productService) CreateProduct(req *models.ProductRequest) (*models.ProductResponse, error) {
+func (s *productService) CreateProduct(ctx context.Context, req *models.ProductRequest) (*models.ProductResponse, error) {
 	product := &models.Product{
 		Name:  req.Name,
 		Price: req.Price,
+		Stock: req.Stock,
 	}
 
-	if err := s.repo.Create(product); err != nil {
+	if err := s.repo.Create(ctx, product); err != nil {
 		return nil, err
 	}
 
-	response := &models.ProductResponse{
-		ID:    product.ID.Hex(),
-		Name:  product.Name,
-		Price: product.Price,
+	return toProductResponse(product), nil
+}
+
+func (s *productService) GetAllProducts(ctx context.Context, query *models.ProductQuery) ([]models.ProductResponse, *models.PageMeta, error) {
+	if query.IncludeDeleted && s.policy.Denies(ctx, auth.PermProductsDelete) {
+		return nil, nil, fmt.Errorf("%w: include_deleted needs %s", auth.ErrForbidden, auth.PermProductsDelete)
 	}
 
-	return response, nil
-}
+	filter, err := buildProductFilter(query)
+	if err != nil {
+		return nil, nil, err
+	}
 
-func (s *productService) GetAllProducts() ([]models.ProductResponse, error) {
-	products, err := s.repo.FindAll()
+	products, total, err := s.repo.FindAll(ctx, filter)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var response []models.ProductResponse
-	for _, p := range products {
-		response = append(response, models.ProductResponse{
-			ID:    p.ID.Hex(),
-			Name:  p.Name,
-			Price: p.Price,
-		})
+	for i := range products {
+		response = append(response, *toProductResponse(&products[i]))
 	}
 
 	if response == nil {
 		response = []models.ProductResponse{}
 	}
 
-	return response, nil
+	meta := &models.PageMeta{
+		Limit: filter.Limit,
+		Total: &total,
+	}
+	if query.After == "" {
+		meta.Page = query.Page
+		if meta.Page == 0 {
+			meta.Page = 1
+		}
+	}
+	// A full page on the _id ordering can be continued with ?after=
+	if query.Sort == "" && int64(len(products)) == filter.Limit {
+		meta.NextCursor = products[len(products)-1].ID.Hex()
+	}
+
+	return response, meta, nil
+}
+
+func buildProductFilter(query *models.ProductQuery) (*models.ProductFilter, error) {
+	minPrice, maxPrice, err := parseMoneyRange(query.MinPrice, query.MaxPrice, query.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &models.ProductFilter{
+		Name:     strings.TrimSpace(query.Name),
+		MinPrice: minPrice,
+		MaxPrice: maxPrice,
+		Sort:     query.Sort,
+		Limit:    query.Limit,
+
+		IncludeDeleted: query.IncludeDeleted,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = models.DefaultPageLimit
+	}
+
+	if query.After != "" {
+		if query.Page > 0 {
+			return nil, fmt.Errorf("%w: after cannot be combined with page", ErrInvalidQuery)
+		}
+		if query.Sort != "" {
+			return nil, fmt.Errorf("%w: after cannot be combined with sort", ErrInvalidQuery)
+		}
+		after, err := primitive.ObjectIDFromHex(query.After)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid after cursor", ErrInvalidQuery)
+		}
+		filter.After = after
+	} else if query.Page > 1 {
+		filter.Skip = (query.Page - 1) * filter.Limit
+	}
+
+	return filter, nil
 }
 
-func (s *productService) GetProductByID(id string) (*models.ProductResponse, error) {
+func (s *productService) GetProductByID(ctx context.Context, id string, includeDeleted bool) (*models.ProductResponse, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, errors.New("invalid product ID")
+		return nil, ErrInvalidProductID
 	}
 
-	product, err := s.repo.FindByID(objectID)
+	if includeDeleted && s.policy.Denies(ctx, auth.PermProductsDelete) {
+		return nil, fmt.Errorf("%w: include_deleted needs %s", auth.ErrForbidden, auth.PermProductsDelete)
+	}
+
+	var product *models.Product
+	if includeDeleted {
+		product, err = s.repo.FindByIDIncludingDeleted(ctx, objectID)
+	} else {
+		product, err = s.repo.FindByID(ctx, objectID)
+	}
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("product not found")
+			return nil, ErrProductNotFound
 		}
 		return nil, err
 	}
 
-	response := &models.ProductResponse{
-		ID:    product.ID.Hex(),
-		Name:  product.Name,
-		Price: product.Price,
-	}
-
-	return response, nil
+	return toProductResponse(product), nil
 }
 
-func (s *productService) UpdateProduct(id string, req *models.ProductRequest) error {
+func (s *productService) UpdateProduct(ctx context.Context, id string, req *models.ProductRequest) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return errors.New("invalid product ID")
+		return ErrInvalidProductID
 	}
 
-	if err := s.repo.Update(objectID, req); err != nil {
+	if err := s.repo.Update(ctx, objectID, req); err != nil {
 		if err == mongo.ErrNoDocuments {
-			return errors.New("product not found")
+			return ErrProductNotFound
 		}
 		return err
 	}
@@ -107,18 +177,127 @@ func (s *productService) UpdateProduct(id string, req *models.ProductRequest) er
 	return nil
 }
 
-func (s *productService) DeleteProduct(id string) error {
+// DeleteProduct soft deletes a product. One that transactions or orders point
+// at is refused unless forced, in which case it is archived with the given
+// reason so the purge job never removes it from under them. Carts are not
+// checked: a cart line whose product is gone shows as unavailable.
+func (s *productService) DeleteProduct(ctx context.Context, id string, query *models.ProductDeleteQuery) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return errors.New("invalid product ID")
+		return ErrInvalidProductID
 	}
 
-	if err := s.repo.Delete(objectID); err != nil {
+	referenced, err := s.isReferenced(ctx, objectID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !referenced:
+		err = s.repo.Delete(ctx, objectID)
+	case query.Force:
+		err = s.repo.Archive(ctx, objectID, query.Reason)
+	default:
+		if _, findErr := s.repo.FindByID(ctx, objectID); findErr == mongo.ErrNoDocuments {
+			return ErrProductNotFound
+		}
+		return ErrProductInUse
+	}
+
+	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return errors.New("product not found")
+			return ErrProductNotFound
 		}
 		return err
 	}
 
 	return nil
 }
+
+func (s *productService) isReferenced(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	checks := []func(context.Context, primitive.ObjectID) (bool, error){
+		s.transactionRepo.ExistsByProductID,
+		s.orderRepo.ExistsByProductID,
+	}
+	for _, exists := range checks {
+		if referenced, err := exists(ctx, id); err != nil || referenced {
+			return referenced, err
+		}
+	}
+	return false, nil
+}
+
+// RestoreProduct undoes a soft delete.
+func (s *productService) RestoreProduct(ctx context.Context, id string) (*models.ProductResponse, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidProductID
+	}
+
+	if err := s.repo.Restore(ctx, objectID); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		if _, findErr := s.repo.FindByIDIncludingDeleted(ctx, objectID); findErr == mongo.ErrNoDocuments {
+			return nil, ErrProductNotFound
+		}
+		return nil, ErrProductNotDeleted
+	}
+
+	product, err := s.repo.FindByID(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toProductResponse(product), nil
+}
+
+// AdjustStock applies a manual stock change. Removing more units than are in
+// stock fails with ErrOutOfStock instead of going negative.
+func (s *productService) AdjustStock(ctx context.Context, id string, req *models.StockAdjustmentRequest) (*models.StockAdjustment, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidProductID
+	}
+
+	return s.inventory.adjust(ctx, objectID, req.Quantity, req.Reason, req.Note, stockOwner{})
+}
+
+func (s *productService) GetStockAdjustments(ctx context.Context, id string) ([]models.StockAdjustment, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidProductID
+	}
+
+	if _, err := s.repo.FindByID(ctx, objectID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
+	adjustments, err := s.inventory.adjustmentRepo.FindByProductID(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+	if adjustments == nil {
+		adjustments = []models.StockAdjustment{}
+	}
+
+	return adjustments, nil
+}
+
+func toProductResponse(p *models.Product) *models.ProductResponse {
+	return &models.ProductResponse{
+		ID:        p.ID.Hex(),
+		Name:      p.Name,
+		Price:     p.Price,
+		Stock:     p.Stock + p.Reserved,
+		Available: p.Stock,
+		Reserved:  p.Reserved,
+		DeletedAt: p.DeletedAt,
+
+		Archived:     p.Archived,
+		DeleteReason: p.DeleteReason,
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"log"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"p3-graded-challenge-1-ziancarlos/repository"
+	"time"
+)
+
+// PurgeJob permanently removes products and transactions that have been soft
+// deleted for longer than the configured retention.
+type PurgeJob struct {
+	productRepo     repository.ProductRepository
+	transactionRepo repository.TransactionRepository
+	cfg             *config.Config
+}
+
+func NewPurgeJob(productRepo repository.ProductRepository, transactionRepo repository.TransactionRepository, cfg *config.Config) *PurgeJob {
+	return &PurgeJob{
+		productRepo:     productRepo,
+		transactionRepo: transactionRepo,
+		cfg:             cfg,
+	}
+}
+
+// Run purges every Interval until ctx is cancelled.
+func (j *PurgeJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.cfg.Purge.Interval)
+	defer ticker.Stop()
+
+	for {
+		j.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *PurgeJob) purge(ctx context.Context) {
+	before := time.Now().Add(-j.cfg.Purge.Retention)
+
+	if n, err := j.transactionRepo.PurgeDeleted(ctx, before); err != nil {
+		log.Printf("purge: failed to purge transactions: %v", err)
+	} else if n > 0 {
+		log.Printf("purge: removed %d transactions deleted before %s", n, before.Format(time.RFC3339))
+	}
+
+	if n, err := j.productRepo.PurgeDeleted(ctx, before); err != nil {
+		log.Printf("purge: failed to purge products: %v", err)
+	} else if n > 0 {
+		log.Printf("purge: removed %d products deleted before %s", n, before.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"p3-graded-challenge-1-ziancarlos/auth"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ReservationService interface {
+	CreateReservation(ctx context.Context, productID string, req *models.ReservationRequest) (*models.Reservation, error)
+	GetReservation(ctx context.Context, id string) (*models.Reservation, error)
+	ReleaseReservation(ctx context.Context, id string) (*models.Reservation, error)
+}
+
+type reservationService struct {
+	inventory *Inventory
+	policy    *auth.Policy
+}
+
+func NewReservationService(inventory *Inventory, policy *auth.Policy) ReservationService {
+	return &reservationService{
+		inventory: inventory,
+		policy:    policy,
+	}
+}
+
+func (s *reservationService) CreateReservation(ctx context.Context, productID string, req *models.ReservationRequest) (*models.Reservation, error) {
+	objectID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, ErrInvalidProductID
+	}
+
+	cfg := s.inventory.cfg.Reservation
+	ttl := cfg.TTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > cfg.MaxTTL {
+		ttl = cfg.MaxTTL
+	}
+
+	reservation, err := s.inventory.reserve(ctx, objectID, req.Quantity, ttl, stockOwner{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Checked once the units are held, so reservations made at the same time
+	// cannot all slip under the limit
+	held, err := s.inventory.reservationRepo.ActiveQuantity(ctx, reservation.CreatedBy, objectID)
+	if err == nil && held > cfg.MaxQuantityPerCustomer {
+		err = fmt.Errorf("%w: at most %d units per product", ErrReservationLimit, cfg.MaxQuantityPerCustomer)
+	}
+	if err != nil {
+		if releaseErr := s.inventory.release(ctx, reservation, models.ReservationStatusActive, models.ReservationStatusReleased); releaseErr != nil {
+			log.Printf("failed to release reservation %s over the customer limit: %v", reservation.ID.Hex(), releaseErr)
+		}
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+func (s *reservationService) GetReservation(ctx context.Context, id string) (*models.Reservation, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidReservationID
+	}
+
+	reservation, err := s.inventory.reservationRepo.FindByID(ctx, objectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrReservationNotFound
+		}
+		return nil, err
+	}
+	if !ownedBy(ctx, s.policy, auth.PermReservationsReadAll, reservation.CreatedBy) {
+		return nil, ErrReservationNotFound
+	}
+
+	return reservation, nil
+}
+
+// ReleaseReservation gives the units back before the reservation expires.
+// Reservations claimed by a transaction follow the transaction instead.
+func (s *reservationService) ReleaseReservation(ctx context.Context, id string) (*models.Reservation, error) {
+	reservation, err := s.GetReservation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if reservation.Status != models.ReservationStatusActive || reservation.TransactionID != nil {
+		return nil, ErrReservationNotActive
+	}
+
+	err = s.inventory.release(ctx, reservation, models.ReservationStatusActive, models.ReservationStatusReleased)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrReservationNotActive
+		}
+		return nil, err
+	}
+
+	reservation.Status = models.ReservationStatusReleased
+	return reservation, nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"log"
+	"p3-graded-challenge-1-ziancarlos/config"
+	"time"
+)
+
+const reservationSweepBatch = 100
+
+// ReservationSweeper returns the units of expired reservations to the
+// available stock.
+type ReservationSweeper struct {
+	inventory *Inventory
+	cfg       *config.Config
+}
+
+func NewReservationSweeper(inventory *Inventory, cfg *config.Config) *ReservationSweeper {
+	return &ReservationSweeper{
+		inventory: inventory,
+		cfg:       cfg,
+	}
+}
+
+// Run sweeps every SweepInterval until ctx is cancelled.
+func (s *ReservationSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Reservation.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		s.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *ReservationSweeper) sweep(ctx context.Context) {
+	for ctx.Err() == nil {
+		released, err := s.inventory.expire(ctx, reservationSweepBatch)
+		if err != nil {
+			log.Printf("reservations: failed to sweep expired reservations: %v", err)
+			return
+		}
+		if released < reservationSweepBatch {
+			return
+		}
+	}
+}
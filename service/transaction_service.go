@@ -1,10 +1,17 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"p3-graded-challenge-1-ziancarlos/auth"
 	"p3-graded-challenge-1-ziancarlos/config"
 	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/paymentclient"
 	"p3-graded-challenge-1-ziancarlos/repository"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -12,131 +19,315 @@ import (
 )
 
 type TransactionService interface {
-	CreateTransaction(req *models.TransactionRequest) (*models.TransactionResponse, error)
-	GetAllTransactions() ([]models.TransactionResponse, error)
-	GetTransactionByID(id string) (*models.TransactionResponse, error)
-	UpdateTransaction(id string, req *models.TransactionUpdateRequest) error
-	DeleteTransaction(id string) error
+	CreateTransaction(ctx context.Context, req *models.TransactionRequest) (*models.TransactionResponse, error)
+	GetAllTransactions(ctx context.Context, query *models.TransactionQuery) ([]models.TransactionResponse, *models.PageMeta, error)
+	GetTransactionByID(ctx context.Context, id string, includeDeleted bool) (*models.TransactionResponse, error)
+	UpdateTransaction(ctx context.Context, id string, req *models.TransactionUpdateRequest) error
+	DeleteTransaction(ctx context.Context, id string) error
+	RestoreTransaction(ctx context.Context, id string) (*models.TransactionResponse, error)
+	CancelTransaction(ctx context.Context, id string, req *models.TransactionCancelRequest) (*models.TransactionResponse, error)
+	RefundTransaction(ctx context.Context, id string, req *models.RefundRequest, idempotencyKey string) (*models.TransactionResponse, error)
 }
 
 type transactionService struct {
-	repo repository.TransactionRepository
-	cfg  *config.Config
+	repo          repository.TransactionRepository
+	productRepo   repository.ProductRepository
+	outboxRepo    repository.OutboxRepository
+	inventory     *Inventory
+	paymentClient paymentclient.Client
+	policy        *auth.Policy
+	cfg           *config.Config
 }
 
-func NewTransactionService(repo repository.TransactionRepository, cfg *config.Config) TransactionService {
+func NewTransactionService(repo repository.TransactionRepository, productRepo repository.ProductRepository, outboxRepo repository.OutboxRepository, inventory *Inventory, paymentClient paymentclient.Client, policy *auth.Policy, cfg *config.Config) TransactionService {
 	return &transactionService{
-		repo: repo,
-		cfg:  cfg,
+		repo:          repo,
+		productRepo:   productRepo,
+		outboxRepo:    outboxRepo,
+		inventory:     inventory,
+		paymentClient: paymentClient,
+		policy:        policy,
+		cfg:           cfg,
 	}
 }
 
-func (s *transactionService) CreateTransaction(req *models.TransactionRequest) (*models.TransactionResponse, error) {
+func (s *transactionService) CreateTransaction(ctx context.Context, req *models.TransactionRequest) (*models.TransactionResponse, error) {
 	productID, err := primitive.ObjectIDFromHex(req.ProductID)
 	if err != nil {
-		return nil, errors.New("invalid product_id")
+		return nil, ErrInvalidProductID
 	}
+
+	// The catalog is the source of truth for the price, checked before any payment is made
+	product, err := s.productRepo.FindByID(ctx, productID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	if !req.Price.IsZero() && req.Price != product.Price {
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrPriceMismatch, product.Price, req.Price)
+	}
+
 	transaction := &models.Transaction{
-		ProductID:     productID,
-		Price:         req.Price,
-		PaymentMethod: req.PaymentMethod,
+		ID:             primitive.NewObjectID(),
+		ProductID:      productID,
+		Quantity:       req.Quantity,
+		UnitPrice:      product.Price,
+		RefundedAmount: models.NewMoney(0, product.Price.Currency),
+		PaymentMethod:  req.PaymentMethod,
+		CreatedBy:      auth.Subject(ctx),
+	}
+
+	// Units are reserved before the transaction exists so two buyers can never
+	// both get the last one; the reservation becomes a sale once the payment
+	// goes through and is released if it fails
+	if err := s.reserveStock(ctx, transaction, req.ReservationID); err != nil {
+		return nil, err
+	}
+	if transaction.Price, err = product.Price.Mul(transaction.Quantity); err != nil {
+		s.inventory.releaseTransaction(ctx, transaction)
+		return nil, err
 	}
 
-	if err := s.repo.Create(transaction); err != nil {
+	if err := s.repo.Create(ctx, transaction); err != nil {
+		s.inventory.releaseTransaction(ctx, transaction)
 		return nil, err
 	}
 
-	response := &models.TransactionResponse{
-		ID:            transaction.ID.Hex(),
-		ProductID:     transaction.ProductID.Hex(),
-		Date:          transaction.Date,
-		Price:         transaction.Price,
-		PaymentMethod: transaction.PaymentMethod,
-		PaymentID:     transaction.PaymentID,
+	// The payment itself is made by the payment worker from this outbox entry
+	entry := &models.OutboxEntry{
+		Type:          models.OutboxTypePaymentCharge,
+		TransactionID: transaction.ID,
+		Amount:        transaction.Price,
+	}
+	if err := s.outboxRepo.Create(ctx, entry); err != nil {
+		reason := "failed to schedule payment"
+		markErr := transitionTransaction(context.WithoutCancel(ctx), s.repo, transaction.ID, models.TransactionStatusPending,
+			models.TransactionStatusFailed, reason, bson.M{"failure_reason": reason})
+		if markErr != nil {
+			log.Printf("failed to mark transaction %s failed: %v", transaction.ID.Hex(), markErr)
+		}
+		s.inventory.releaseTransaction(ctx, transaction)
+		return nil, fmt.Errorf("failed to schedule payment: %w", err)
 	}
 
-	return response, nil
+	return toTransactionResponse(transaction), nil
 }
 
-func (s *transactionService) GetAllTransactions() ([]models.TransactionResponse, error) {
-	transactions, err := s.repo.FindAll()
+// reserveStock claims the buyer's existing reservation, or reserves the
+// requested quantity (default 1) for the transaction.
+func (s *transactionService) reserveStock(ctx context.Context, transaction *models.Transaction, reservationID string) error {
+	if reservationID == "" {
+		if transaction.Quantity == 0 {
+			transaction.Quantity = 1
+		}
+		reservation, err := s.inventory.reserve(ctx, transaction.ProductID, transaction.Quantity, s.cfg.Reservation.TTL, transactionOwner(transaction))
+		if err != nil {
+			return err
+		}
+		transaction.ReservationID = &reservation.ID
+		return nil
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(reservationID)
 	if err != nil {
-		return nil, err
+		return ErrInvalidReservationID
+	}
+	reservation, err := s.inventory.reservationRepo.FindByID(ctx, objectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrReservationNotFound
+		}
+		return err
+	}
+	if !ownedBy(ctx, s.policy, auth.PermReservationsReadAll, reservation.CreatedBy) {
+		return ErrReservationNotFound
+	}
+	if reservation.ProductID != transaction.ProductID {
+		return fmt.Errorf("%w: reservation is for another product", ErrReservationMismatch)
+	}
+	if transaction.Quantity != 0 && transaction.Quantity != reservation.Quantity {
+		return fmt.Errorf("%w: reservation holds %d units", ErrReservationMismatch, reservation.Quantity)
+	}
+
+	if _, err := s.inventory.attach(ctx, objectID, transaction.ID); err != nil {
+		return err
+	}
+	transaction.Quantity = reservation.Quantity
+	transaction.ReservationID = &objectID
+	return nil
+}
+
+func (s *transactionService) GetAllTransactions(ctx context.Context, query *models.TransactionQuery) ([]models.TransactionResponse, *models.PageMeta, error) {
+	if query.IncludeDeleted && s.policy.Denies(ctx, auth.PermTransactionsDelete) {
+		return nil, nil, fmt.Errorf("%w: include_deleted needs %s", auth.ErrForbidden, auth.PermTransactionsDelete)
+	}
+
+	filter, err := buildTransactionFilter(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter.CreatedBy = ownerScope(ctx, s.policy, auth.PermTransactionsReadAll)
+
+	transactions, err := s.repo.FindAll(ctx, filter)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	var response []models.TransactionResponse
-	for _, t := range transactions {
-		response = append(response, models.TransactionResponse{
-			ID:            t.ID.Hex(),
-			ProductID:     t.ProductID.Hex(),
-			Date:          t.Date,
-			Price:         t.Price,
-			PaymentMethod: t.PaymentMethod,
-			PaymentID:     t.PaymentID,
-		})
+	for i := range transactions {
+		response = append(response, *toTransactionResponse(&transactions[i]))
 	}
 
 	if response == nil {
 		response = []models.TransactionResponse{}
 	}
 
-	return response, nil
+	meta := &models.PageMeta{Limit: filter.Limit}
+	if int64(len(transactions)) == filter.Limit {
+		last := transactions[len(transactions)-1]
+		meta.NextCursor = encodeCursor(last.Date, last.ID)
+	}
+
+	return response, meta, nil
+}
+
+func buildTransactionFilter(query *models.TransactionQuery) (*models.TransactionFilter, error) {
+	minPrice, maxPrice, err := parseMoneyRange(query.MinPrice, query.MaxPrice, query.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &models.TransactionFilter{
+		PaymentMethod: query.PaymentMethod,
+		MinPrice:      minPrice,
+		MaxPrice:      maxPrice,
+		Limit:         query.Limit,
+
+		IncludeDeleted: query.IncludeDeleted,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = models.DefaultPageLimit
+	}
+
+	if query.ProductID != "" {
+		productID, err := primitive.ObjectIDFromHex(query.ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid product_id", ErrInvalidQuery)
+		}
+		filter.ProductID = productID
+	}
+
+	if query.From != "" {
+		if filter.From, err = parseQueryTime(query.From); err != nil {
+			return nil, fmt.Errorf("%w: invalid from date", ErrInvalidQuery)
+		}
+	}
+	if query.To != "" {
+		if filter.To, err = parseQueryTime(query.To); err != nil {
+			return nil, fmt.Errorf("%w: invalid to date", ErrInvalidQuery)
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+
+	if query.Cursor != "" {
+		filter.CursorDate, filter.CursorID, err = decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+		}
+	}
+
+	return filter, nil
 }
 
-func (s *transactionService) GetTransactionByID(id string) (*models.TransactionResponse, error) {
+// parseQueryTime accepts a full RFC 3339 timestamp or a plain YYYY-MM-DD date (UTC midnight).
+func parseQueryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+func (s *transactionService) GetTransactionByID(ctx context.Context, id string, includeDeleted bool) (*models.TransactionResponse, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, errors.New("invalid transaction ID")
+		return nil, ErrInvalidTransactionID
+	}
+
+	if includeDeleted && s.policy.Denies(ctx, auth.PermTransactionsDelete) {
+		return nil, fmt.Errorf("%w: include_deleted needs %s", auth.ErrForbidden, auth.PermTransactionsDelete)
 	}
 
-	transaction, err := s.repo.FindByID(objectID)
+	var transaction *models.Transaction
+	if includeDeleted {
+		transaction, err = s.repo.FindByIDIncludingDeleted(ctx, objectID)
+	} else {
+		transaction, err = s.repo.FindByID(ctx, objectID)
+	}
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("transaction not found")
+			return nil, ErrTransactionNotFound
 		}
 		return nil, err
 	}
-
-	response := &models.TransactionResponse{
-		ID:            transaction.ID.Hex(),
-		ProductID:     transaction.ProductID.Hex(),
-		Date:          transaction.Date,
-		Price:         transaction.Price,
-		PaymentMethod: transaction.PaymentMethod,
-		PaymentID:     transaction.PaymentID,
+	if !s.visible(ctx, transaction) {
+		return nil, ErrTransactionNotFound
 	}
 
-	return response, nil
+	return toTransactionResponse(transaction), nil
 }
 
-func (s *transactionService) UpdateTransaction(id string, req *models.TransactionUpdateRequest) error {
+// visible reports whether the caller may see the transaction.
+func (s *transactionService) visible(ctx context.Context, transaction *models.Transaction) bool {
+	return ownedBy(ctx, s.policy, auth.PermTransactionsReadAll, transaction.CreatedBy)
+}
+
+// UpdateTransaction changes only the fields that are safe in the
+// transaction's current status and rejects the whole request otherwise.
+func (s *transactionService) UpdateTransaction(ctx context.Context, id string, req *models.TransactionUpdateRequest) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return errors.New("invalid transaction ID")
+		return ErrInvalidTransactionID
 	}
 
-	updateData := bson.M{}
-	if req.ProductID != "" {
-		productID, err := primitive.ObjectIDFromHex(req.ProductID)
-		if err != nil {
-			return errors.New("invalid product_id")
+	transaction, err := s.repo.FindByID(ctx, objectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrTransactionNotFound
 		}
-		updateData["product_id"] = productID
+		return err
+	}
+	if !s.visible(ctx, transaction) {
+		return ErrTransactionNotFound
 	}
-	if req.Price > 0 {
-		updateData["price"] = req.Price
+
+	requested := bson.M{}
+	if !req.Price.IsZero() {
+		requested["price"] = req.Price
+	}
+	if req.PaymentID != "" {
+		requested["payment_id"] = req.PaymentID
 	}
 	if req.PaymentMethod != "" {
-		updateData["payment_method"] = req.PaymentMethod
+		requested["payment_method"] = req.PaymentMethod
 	}
 
-	if len(updateData) == 0 {
-		return errors.New("no fields to update")
+	if len(requested) == 0 {
+		return ErrNoFieldsToUpdate
+	}
+	for field := range requested {
+		if !canUpdateTransactionField(transaction.Status, field) {
+			return fmt.Errorf("%w: %s cannot be changed while the transaction is %s", ErrTransactionFieldLocked, field, transaction.Status)
+		}
 	}
 
-	if err := s.repo.Update(objectID, updateData); err != nil {
+	if err := s.repo.Update(ctx, objectID, transaction.Status, requested); err != nil {
 		if err == mongo.ErrNoDocuments {
-			return errors.New("transaction not found")
+			// The status changed under us; the fields may no longer be editable
+			return fmt.Errorf("%w: transaction is no longer %s", ErrTransactionFieldLocked, transaction.Status)
 		}
 		return err
 	}
@@ -144,18 +335,212 @@ func (s *transactionService) UpdateTransaction(id string, req *models.Transactio
 	return nil
 }
 
-func (s *transactionService) DeleteTransaction(id string) error {
+func (s *transactionService) DeleteTransaction(ctx context.Context, id string) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return errors.New("invalid transaction ID")
+		return ErrInvalidTransactionID
 	}
 
-	if err := s.repo.Delete(objectID); err != nil {
-		if err == mongo.ErrNoDocuments {
-			return errors.New("transaction not found")
+	if err := s.repo.Delete(ctx, objectID); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return err
 		}
-		return err
+		// A pending transaction may still be charged, so it has to be
+		// cancelled first to void its payment and release its stock
+		if transaction, findErr := s.repo.FindByID(ctx, objectID); findErr == nil && transaction.Status == models.TransactionStatusPending {
+			return ErrTransactionPending
+		}
+		return ErrTransactionNotFound
 	}
 
 	return nil
 }
+
+// RestoreTransaction undoes a soft delete.
+func (s *transactionService) RestoreTransaction(ctx context.Context, id string) (*models.TransactionResponse, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidTransactionID
+	}
+
+	if err := s.repo.Restore(ctx, objectID); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		if _, findErr := s.repo.FindByIDIncludingDeleted(ctx, objectID); findErr == mongo.ErrNoDocuments {
+			return nil, ErrTransactionNotFound
+		}
+		return nil, ErrTransactionNotDeleted
+	}
+
+	transaction, err := s.repo.FindByID(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toTransactionResponse(transaction), nil
+}
+
+// CancelTransaction cancels a transaction that has not been paid yet. Its
+// units go back to stock, and a payment the worker already authorized is
+// voided. If the worker is confirming the payment at the same moment, it
+// finds the transaction cancelled and refunds the payment itself.
+func (s *transactionService) CancelTransaction(ctx context.Context, id string, req *models.TransactionCancelRequest) (*models.TransactionResponse, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidTransactionID
+	}
+
+	transaction, err := s.repo.FindByID(ctx, objectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrTransactionNotFound
+		}
+		return nil, err
+	}
+	if !s.visible(ctx, transaction) {
+		return nil, ErrTransactionNotFound
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = "cancelled by buyer"
+	}
+	err = transitionTransaction(ctx, s.repo, objectID, transaction.Status, models.TransactionStatusCancelled, reason, nil)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("%w: transaction changed status, try again", ErrInvalidTransactionTransition)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Reload for the payment the worker may have authorized meanwhile
+	if transaction, err = s.repo.FindByID(ctx, objectID); err != nil {
+		return nil, err
+	}
+	s.inventory.releaseTransaction(ctx, transaction)
+	if transaction.PaymentID != "" {
+		entry := &models.OutboxEntry{
+			Type:          models.OutboxTypePaymentVoid,
+			TransactionID: transaction.ID,
+			PaymentID:     transaction.PaymentID,
+			Amount:        transaction.Price,
+		}
+		if err := s.outboxRepo.Create(ctx, entry); err != nil {
+			log.Printf("failed to schedule void for cancelled transaction %s: %v", id, err)
+		}
+	}
+
+	return toTransactionResponse(transaction), nil
+}
+
+// RefundTransaction refunds part or all of a paid transaction through the
+// payment service, which keeps the refund records and enforces that refunds
+// never exceed the original amount.
+func (s *transactionService) RefundTransaction(ctx context.Context, id string, req *models.RefundRequest, idempotencyKey string) (*models.TransactionResponse, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidTransactionID
+	}
+
+	transaction, err := s.repo.FindByID(ctx, objectID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrTransactionNotFound
+		}
+		return nil, err
+	}
+
+	if transaction.Status != models.TransactionStatusPaid || transaction.PaymentID == "" {
+		return nil, fmt.Errorf("%w: transaction is %s", ErrTransactionNotRefundable, transaction.Status)
+	}
+	alreadyRefunded := zeroIfUnset(transaction.RefundedAmount, transaction.Price.Currency)
+	remaining, err := transaction.Price.Sub(alreadyRefunded)
+	if err != nil {
+		return nil, err
+	}
+	if !remaining.IsPositive() {
+		return nil, fmt.Errorf("%w: transaction is already fully refunded", ErrTransactionNotRefundable)
+	}
+	if !req.Amount.IsZero() {
+		if exceeds, err := req.Amount.Cmp(remaining); err != nil {
+			return nil, err
+		} else if exceeds > 0 {
+			return nil, fmt.Errorf("%w: %s left to refund", ErrRefundExceedsTransaction, remaining)
+		}
+	}
+
+	// Without a client key every call is a new refund; with one, retries reach
+	// the payment service with the same key and are applied only once
+	if idempotencyKey == "" {
+		idempotencyKey = primitive.NewObjectID().Hex()
+	}
+	refund, err := s.paymentClient.RefundPayment(ctx, transaction.PaymentID, req, "refund-"+id+"-"+idempotencyKey)
+	if err != nil {
+		return nil, refundError(err)
+	}
+
+	// The money has moved; record it even if the client has stopped waiting
+	ctx = context.WithoutCancel(ctx)
+
+	if err := s.repo.SetRefundedAmount(ctx, objectID, refund.Payment.RefundedAmount); err != nil {
+		return nil, err
+	}
+	if refund.Payment.RefundedAmount.Amount > alreadyRefunded.Amount {
+		transaction.RefundedAmount = refund.Payment.RefundedAmount
+	}
+
+	if transaction.RefundedAmount == transaction.Price {
+		err := transitionTransaction(ctx, s.repo, objectID, models.TransactionStatusPaid, models.TransactionStatusRefunded, req.Reason, nil)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		transaction.Status = models.TransactionStatusRefunded
+	}
+
+	return toTransactionResponse(transaction), nil
+}
+
+// refundError translates payment service rejections into service errors.
+func refundError(err error) error {
+	var statusErr *paymentclient.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusUnprocessableEntity:
+			return fmt.Errorf("%w: %s", ErrRefundExceedsTransaction, statusErr.Body)
+		case http.StatusConflict:
+			return fmt.Errorf("%w: %s", ErrTransactionNotRefundable, statusErr.Body)
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrPaymentServiceUnavailable, err)
+}
+
+func toTransactionResponse(t *models.Transaction) *models.TransactionResponse {
+	// Transactions from before quantities were tracked are a single unit
+	quantity, unitPrice := t.Quantity, t.UnitPrice
+	if quantity == 0 {
+		quantity, unitPrice = 1, t.Price
+	}
+	var reservationID string
+	if t.ReservationID != nil {
+		reservationID = t.ReservationID.Hex()
+	}
+
+	return &models.TransactionResponse{
+		ID:             t.ID.Hex(),
+		ProductID:      t.ProductID.Hex(),
+		Date:           t.Date,
+		Quantity:       quantity,
+		ReservationID:  reservationID,
+		UnitPrice:      unitPrice,
+		Price:          t.Price,
+		PaymentMethod:  t.PaymentMethod,
+		PaymentID:      t.PaymentID,
+		Status:         t.Status,
+		FailureReason:  t.FailureReason,
+		RefundedAmount: zeroIfUnset(t.RefundedAmount, t.Price.Currency),
+		StatusHistory:  t.StatusHistory,
+		CreatedBy:      t.CreatedBy,
+		DeletedAt:      t.DeletedAt,
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-1-ziancarlos/models"
+	"p3-graded-challenge-1-ziancarlos/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// transactionTransitions lists the statuses each transaction status may move
+// to. Failed, cancelled and refunded transactions are final; a partial refund
+// keeps the transaction paid.
+var transactionTransitions = map[string][]string{
+	models.TransactionStatusPending: {models.TransactionStatusPaid, models.TransactionStatusFailed, models.TransactionStatusCancelled},
+	models.TransactionStatusPaid:    {models.TransactionStatusRefunded},
+}
+
+func canTransitionTransaction(from, to string) bool {
+	for _, allowed := range transactionTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transitionTransaction is the only way a transaction changes status. It
+// checks the move against transactionTransitions and applies it only if the
+// transaction is still in status from, so concurrent writers cannot both win.
+func transitionTransaction(ctx context.Context, repo repository.TransactionRepository, id primitive.ObjectID, from, to, reason string, fields bson.M) error {
+	if !canTransitionTransaction(from, to) {
+		return fmt.Errorf("%w: cannot move from %s to %s", ErrInvalidTransactionTransition, from, to)
+	}
+	return repo.UpdateStatus(ctx, id, from, to, reason, fields)
+}
+
+// transactionUpdatableFields lists the fields UpdateTransaction may change in
+// each status. Only the payment method of a pending transaction can change;
+// product and price are fixed once the units are reserved and priced.
+var transactionUpdatableFields = map[string][]string{
+	models.TransactionStatusPending: {"payment_method"},
+}
+
+func canUpdateTransactionField(status, field string) bool {
+	for _, allowed := range transactionUpdatableFields[status] {
+		if allowed == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"p3-graded-challenge-1-ziancarlos/models"
+	"testing"
+)
+
+func TestCanTransitionTransaction(t *testing.T) {
+	statuses := []string{
+		models.TransactionStatusPending,
+		models.TransactionStatusPaid,
+		models.TransactionStatusFailed,
+		models.TransactionStatusCancelled,
+		models.TransactionStatusRefunded,
+	}
+	allowed := map[[2]string]bool{
+		{models.TransactionStatusPending, models.TransactionStatusPaid}:      true,
+		{models.TransactionStatusPending, models.TransactionStatusFailed}:    true,
+		{models.TransactionStatusPending, models.TransactionStatusCancelled}: true,
+		{models.TransactionStatusPaid, models.TransactionStatusRefunded}:     true,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]string{from, to}]
+			if got := canTransitionTransaction(from, to); got != want {
+				t.Errorf("canTransitionTransaction(%q, %q) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestCanUpdateTransactionField(t *testing.T) {
+	tests := []struct {
+		status string
+		field  string
+		want   bool
+	}{
+		{models.TransactionStatusPending, "payment_method", true},
+		{models.TransactionStatusPending, "product_id", false},
+		{models.TransactionStatusPending, "price", false},
+		{models.TransactionStatusPaid, "payment_method", false},
+		{models.TransactionStatusRefunded, "payment_method", false},
+	}
+	for _, tt := range tests {
+		if got := canUpdateTransactionField(tt.status, tt.field); got != tt.want {
+			t.Errorf("canUpdateTransactionField(%q, %q) = %v, want %v", tt.status, tt.field, got, tt.want)
+		}
+	}
+}
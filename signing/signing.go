@@ -0,0 +1,116 @@
+// Package signing authenticates requests between the shopping and payment
+// services with an HMAC-SHA256 signature over the method, path and query,
+// timestamp, nonce and body. The timestamp bounds how long a captured request
+// stays usable and the nonce makes it usable once within that window.
+package signing
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"p3-graded-challenge-1-ziancarlos/apperrors"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderTimestamp = "X-Signature-Timestamp"
+	HeaderNonce     = "X-Signature-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+var (
+	ErrMissingSignature = apperrors.Unauthenticated("missing_signature", "request is not signed")
+	ErrInvalidSignature = apperrors.Unauthenticated("invalid_signature", "request signature is invalid")
+	ErrStaleRequest     = apperrors.Unauthenticated("stale_request", "request timestamp is outside the allowed window")
+	ErrReplayedRequest  = apperrors.Unauthenticated("replayed_request", "request nonce has already been used")
+)
+
+var noncePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{16,128}$`)
+
+// NonceStore remembers nonces until they expire.
+type NonceStore interface {
+	// Claim records nonce and reports false if it was already recorded.
+	Claim(ctx context.Context, nonce string, expiresAt time.Time) (bool, error)
+}
+
+// Sign sets the signature headers on req for body, using a fresh nonce.
+func Sign(req *http.Request, body []byte, secret []byte) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonceHex)
+	req.Header.Set(HeaderSignature, signature(secret, req.Method, req.URL.RequestURI(), timestamp, nonceHex, body))
+	return nil
+}
+
+// Verifier checks signed requests.
+type Verifier struct {
+	secret  []byte
+	maxSkew time.Duration
+	nonces  NonceStore
+}
+
+// NewVerifier accepts requests whose timestamp is within maxSkew of now in
+// either direction.
+func NewVerifier(secret []byte, maxSkew time.Duration, nonces NonceStore) *Verifier {
+	return &Verifier{secret: secret, maxSkew: maxSkew, nonces: nonces}
+}
+
+// Verify checks the signature of req for body, then its timestamp, and
+// finally claims its nonce so the same request is rejected if sent again.
+func (v *Verifier) Verify(ctx context.Context, req *http.Request, body []byte) error {
+	timestamp := req.Header.Get(HeaderTimestamp)
+	nonce := req.Header.Get(HeaderNonce)
+	given := req.Header.Get(HeaderSignature)
+	if timestamp == "" || nonce == "" || given == "" {
+		return ErrMissingSignature
+	}
+
+	expected := signature(v.secret, req.Method, req.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(given), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed timestamp", ErrInvalidSignature)
+	}
+	if !noncePattern.MatchString(nonce) {
+		return fmt.Errorf("%w: malformed nonce", ErrInvalidSignature)
+	}
+	signedAt := time.Unix(seconds, 0)
+	if skew := time.Since(signedAt); skew > v.maxSkew || skew < -v.maxSkew {
+		return ErrStaleRequest
+	}
+
+	// Once the timestamp leaves the window the request is stale anyway, so
+	// the nonce only has to be remembered until then
+	fresh, err := v.nonces.Claim(ctx, nonce, signedAt.Add(v.maxSkew))
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrReplayedRequest
+	}
+	return nil
+}
+
+func signature(secret []byte, method, requestURI, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", method, requestURI, timestamp, nonce, hex.EncodeToString(bodyHash[:]))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,138 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// memoryNonces is a NonceStore for tests.
+type memoryNonces map[string]bool
+
+func (m memoryNonces) Claim(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	if m[nonce] {
+		return false, nil
+	}
+	m[nonce] = true
+	return true, nil
+}
+
+func TestVerify(t *testing.T) {
+	secret := []byte("test-secret")
+	body := []byte(`{"amount":{"amount":12.5,"currency":"USD"}}`)
+
+	tests := []struct {
+		name    string
+		change  func(req *http.Request)
+		body    []byte
+		wantErr error
+	}{
+		{name: "valid"},
+		{
+			name:    "missing signature",
+			change:  func(req *http.Request) { req.Header.Del(HeaderSignature) },
+			wantErr: ErrMissingSignature,
+		},
+		{
+			name:    "missing nonce",
+			change:  func(req *http.Request) { req.Header.Del(HeaderNonce) },
+			wantErr: ErrMissingSignature,
+		},
+		{
+			name:    "tampered body",
+			body:    []byte(`{"amount":{"amount":1250,"currency":"USD"}}`),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "tampered path",
+			change:  func(req *http.Request) { req.URL.Path = "/payments/other/capture" },
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "tampered query",
+			change:  func(req *http.Request) { req.URL.RawQuery = "limit=100" },
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "other method",
+			change:  func(req *http.Request) { req.Method = http.MethodDelete },
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "wrong secret",
+			change: func(req *http.Request) {
+				resign(req, body, []byte("other-secret"), req.Header.Get(HeaderTimestamp))
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "stale timestamp",
+			change: func(req *http.Request) {
+				resign(req, body, secret, strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10))
+			},
+			wantErr: ErrStaleRequest,
+		},
+		{
+			name: "future timestamp",
+			change: func(req *http.Request) {
+				resign(req, body, secret, strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10))
+			},
+			wantErr: ErrStaleRequest,
+		},
+		{
+			name:    "malformed timestamp",
+			change:  func(req *http.Request) { resign(req, body, secret, "yesterday") },
+			wantErr: ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/payments/abc/capture?limit=10", bytes.NewReader(body))
+			if err := Sign(req, body, secret); err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if tt.change != nil {
+				tt.change(req)
+			}
+			received := body
+			if tt.body != nil {
+				received = tt.body
+			}
+
+			verifier := NewVerifier(secret, 5*time.Minute, memoryNonces{})
+			err := verifier.Verify(context.Background(), req, received)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	secret := []byte("test-secret")
+	body := []byte(`{}`)
+	req := httptest.NewRequest(http.MethodPost, "/payments", bytes.NewReader(body))
+	if err := Sign(req, body, secret); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	verifier := NewVerifier(secret, 5*time.Minute, memoryNonces{})
+	if err := verifier.Verify(context.Background(), req, body); err != nil {
+		t.Fatalf("first Verify() error = %v", err)
+	}
+	if err := verifier.Verify(context.Background(), req, body); !errors.Is(err, ErrReplayedRequest) {
+		t.Errorf("second Verify() error = %v, want %v", err, ErrReplayedRequest)
+	}
+}
+
+// resign signs req again with the given secret and timestamp, keeping its nonce.
+func resign(req *http.Request, body, secret []byte, timestamp string) {
+	nonce := req.Header.Get(HeaderNonce)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, signature(secret, req.Method, req.URL.RequestURI(), timestamp, nonce, body))
+}